@@ -2,19 +2,21 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"strings"
 
-	// "github.com/danmrichards/sandbox/toyscraper/internal/classifier"
-
 	"github.com/danmrichards/sandbox/toyscraper/internal/classifier"
 	"github.com/danmrichards/sandbox/toyscraper/internal/cleaner"
 	"github.com/danmrichards/sandbox/toyscraper/internal/config"
 	"github.com/danmrichards/sandbox/toyscraper/internal/converter"
 	"github.com/danmrichards/sandbox/toyscraper/internal/extractor"
+	"github.com/danmrichards/sandbox/toyscraper/internal/language"
+	"github.com/danmrichards/sandbox/toyscraper/internal/pipeline"
 	"github.com/danmrichards/sandbox/toyscraper/internal/schema"
 	"github.com/danmrichards/sandbox/toyscraper/internal/scraper"
 )
@@ -26,6 +28,42 @@ func main() {
 		classifierModelDir string
 		classify           bool
 		timeout            int
+		cleanMode          string
+		boilerplate        string
+		preserve           string
+		preserveContact    bool
+		specialLinks       string
+		images             string
+		forms              string
+		lang               string
+		keepHidden         bool
+		profile            string
+		noExtract          bool
+		format             string
+		conversion         string
+		headingStyle       string
+		bulletMarker       string
+		linkStyle          string
+		codeFence          string
+		markdownImages     bool
+		markdownLinks      bool
+		normalise          bool
+		chunkTokens        int
+		chunkOverlap       int
+		frontMatter        bool
+		debug              bool
+
+		listing        bool
+		detailSelector string
+		detailPattern  string
+		externalLinks  bool
+		classifyLinks  bool
+		stripTemplates bool
+
+		nextSelector string
+		pageTemplate string
+		nextButton   string
+		maxPages     int
 	)
 
 	flag.StringVar(&url, "url", "", "URL to scrape")
@@ -33,39 +71,166 @@ func main() {
 	flag.StringVar(&classifierModel, "classifier-model", config.DefaultClassifierModel, "Classifier model to use")
 	flag.StringVar(&classifierModelDir, "classifier-model-dir", config.DefaultClassifierModelDir, "Directory for classifier models")
 	flag.IntVar(&timeout, "timeout", config.DefaultTimeout, "Timeout in seconds")
+	flag.StringVar(&cleanMode, "clean-mode", "full", "Cleaning mode: full keeps the whole page, main keeps only the primary content")
+	flag.StringVar(&boilerplate, "boilerplate", "off", "Boilerplate removal level: off, landmarks or aggressive")
+	flag.StringVar(&preserve, "preserve", "", "Comma-separated CSS selectors for blocks never removed as boilerplate")
+	flag.BoolVar(&preserveContact, "preserve-contact", true, "Keep boilerplate blocks that hold contact details")
+	flag.StringVar(&specialLinks, "special-links", "keep", "Handling of javascript:, mailto: and tel: links: keep, unwrap or drop")
+	flag.StringVar(&images, "images", "with-alt", "Image handling: with-alt, drop, alt, keep or figure")
+	flag.StringVar(&forms, "forms", "keep", "Form handling: keep, summarise or drop")
+	flag.StringVar(&lang, "lang", "", "Content language as an ISO 639-1 code, such as en, de, fr or nl (default: detected)")
+	flag.BoolVar(&keepHidden, "keep-hidden", false, "Keep elements that are hidden, screen-reader-only or aria-hidden in the rendered page")
+	flag.StringVar(&profile, "profile", "", "Path to a YAML or JSON cleaning profile with CSS selector rules")
+	flag.BoolVar(&noExtract, "no-extract", false, "Output the converted content instead of extracting structured content")
+	flag.StringVar(&format, "format", "markdown", "Output format with -no-extract: markdown, text, json or html")
+	flag.StringVar(&conversion, "conversion", "", "Path to a YAML or JSON file of Markdown conversion options and custom element rules")
+	flag.StringVar(&headingStyle, "heading-style", "", "Markdown heading style: atx or setext (default: atx)")
+	flag.StringVar(&bulletMarker, "bullet-marker", "", "Markdown list item marker: -, * or + (default: -)")
+	flag.StringVar(&linkStyle, "link-style", "", "Markdown link style: inline or reference (default: inline)")
+	flag.StringVar(&codeFence, "code-fence", "", "Markdown code block fence: backticks or tildes (default: backticks)")
+	flag.BoolVar(&markdownImages, "markdown-images", true, "Keep images in the Markdown")
+	flag.BoolVar(&markdownLinks, "markdown-links", true, "Keep links in the Markdown; otherwise only their text is kept")
+	flag.BoolVar(&normalise, "normalise", false, "Tidy the Markdown: collapse blank lines and link-only lists, remove needless escapes, empty list items, duplicate links and repeated boilerplate blocks")
+	flag.IntVar(&chunkTokens, "chunk-tokens", 0, "Split the Markdown by heading into chunks of at most this many tokens, classified and extracted separately (default: no chunking)")
+	flag.IntVar(&chunkOverlap, "chunk-overlap", config.ChunkOverlapTokens, "Tokens of content repeated from the previous chunk when a section is split")
+	flag.BoolVar(&frontMatter, "front-matter", false, "Prepend YAML front matter with page metadata to the converted Markdown or text and the first chunk")
+	flag.BoolVar(&debug, "debug", false, "Report what cleaning removed from each page as JSON")
+	flag.BoolVar(&listing, "listing", false, "Treat the URL as a listing page and extract each detail page it links to")
+	flag.StringVar(&detailSelector, "detail-selector", config.DefaultDetailLinkSelector, "CSS selector for detail links on listing pages")
+	flag.StringVar(&detailPattern, "detail-pattern", "", "Regular expression detail link URLs must match")
+	flag.BoolVar(&externalLinks, "external-links", false, "Allow detail links to other hosts than the listing page")
+	flag.BoolVar(&classifyLinks, "classify-links", false, "Use the classifier to identify detail links on listing pages")
+	flag.BoolVar(&stripTemplates, "strip-templates", false, "Remove blocks repeated across the detail pages of a site, keeping them once as site context")
+	flag.StringVar(&nextSelector, "next-selector", "", "CSS selector for the next page link on listing pages (default: rel=next links)")
+	flag.StringVar(&pageTemplate, "page-template", "", "Listing page URL template, with "+config.PageNumberPlaceholder+" replaced by the page number")
+	flag.StringVar(&nextButton, "next-button", "", "CSS selector for a next page button to click on listing pages")
+	flag.IntVar(&maxPages, "max-pages", config.DefaultMaxPages, "Maximum number of listing pages to follow")
 	flag.Parse()
 
 	if url == "" {
 		log.Fatal("URL is required. Use -url flag to specify the URL to scrape.")
 	}
 
-	// Load the extractor API key from environment variables.
-	geminiAPIKey := os.Getenv("GEMINI_API_KEY")
-	if geminiAPIKey == "" {
-		log.Fatal("EXTRACTOR_API_KEY environment variable is required.")
+	mode, err := cleaner.ParseMode(cleanMode)
+	if err != nil {
+		log.Fatalf("Invalid clean mode: %v", err)
 	}
 
-	// Get the HTML content of the page
-	content, err := scraper.GetHTML(url, timeout)
+	level, err := cleaner.ParseBoilerplate(boilerplate)
 	if err != nil {
-		log.Fatalf("Failed to scrape URL: %v", err)
+		log.Fatalf("Invalid boilerplate level: %v", err)
 	}
 
-	// Clean HTML
-	cleanedContent, err := cleaner.HTML(content)
+	special, err := cleaner.ParseSpecialLinks(specialLinks)
 	if err != nil {
-		log.Fatalf("Failed to clean HTML: %v", err)
+		log.Fatalf("Invalid special link handling: %v", err)
 	}
 
-	// Convert HTML to Markdown
-	markdown, err := converter.ToMarkdown(cleanedContent)
+	imageMode, err := cleaner.ParseImages(images)
 	if err != nil {
-		log.Fatalf("Failed to convert HTML to Markdown: %v", err)
+		log.Fatalf("Invalid image handling: %v", err)
+	}
+
+	formMode, err := cleaner.ParseForms(forms)
+	if err != nil {
+		log.Fatalf("Invalid form handling: %v", err)
+	}
+
+	cleaning := cleaner.Options{
+		Mode:            mode,
+		Boilerplate:     level,
+		PreserveContact: preserveContact,
+		SpecialLinks:    special,
+		Images:          imageMode,
+		Forms:           formMode,
+		Language:        language.Base(lang),
+		KeepHidden:      keepHidden,
+		Report:          debug,
+	}
+	if preserve != "" {
+		cleaning.Preserve = strings.Split(preserve, ",")
+	}
+	if profile != "" {
+		if cleaning.Profile, err = cleaner.LoadProfile(profile); err != nil {
+			log.Fatalf("Failed to load cleaning profile: %v", err)
+		}
+	}
+
+	outputFormat, err := converter.ParseFormat(format)
+	if err != nil {
+		log.Fatalf("Invalid output format: %v", err)
+	}
+	if frontMatter && (outputFormat == converter.JSON || outputFormat == converter.HTML) {
+		log.Fatalf("Invalid output format: front matter needs the markdown or text format, not %s", format)
+	}
+
+	// Flags override the conversion options file
+	var conv converter.Options
+	if conversion != "" {
+		if conv, err = converter.LoadOptions(conversion); err != nil {
+			log.Fatalf("Failed to load conversion options: %v", err)
+		}
+	}
+	if headingStyle != "" {
+		conv.HeadingStyle = headingStyle
+	}
+	if bulletMarker != "" {
+		conv.BulletMarker = bulletMarker
+	}
+	if linkStyle != "" {
+		conv.LinkStyle = linkStyle
+	}
+	if codeFence != "" {
+		conv.CodeFence = codeFence
+	}
+	if !markdownImages {
+		conv.DropImages = true
+	}
+	if !markdownLinks {
+		conv.DropLinks = true
+	}
+	if err = conv.Validate(); err != nil {
+		log.Fatalf("Invalid conversion options: %v", err)
+	}
+
+	p := &pipeline.Pipeline{
+		Timeout:     timeout,
+		Cleaning:    cleaning,
+		Conversion:  conv,
+		Normalise:   normalise,
+		FrontMatter: frontMatter,
+		Format:      outputFormat,
+	}
+	if chunkTokens > 0 {
+		p.Chunking = &converter.ChunkOptions{MaxTokens: chunkTokens, Overlap: chunkOverlap}
+	}
+
+	if !noExtract {
+		// Load the extractor API key from environment variables.
+		geminiAPIKey := os.Getenv("GEMINI_API_KEY")
+		if geminiAPIKey == "" {
+			log.Fatal("EXTRACTOR_API_KEY environment variable is required.")
+		}
+
+		ext, err := extractor.NewExtractor(context.Background(), geminiAPIKey)
+		if err != nil {
+			log.Fatalf("Failed to create extractor: %v", err)
+		}
+
+		// Use a JSON schema to structure the extracted content.
+		jobSchema, err := schema.JSONSchemaString(schema.JobPosting{})
+		if err != nil {
+			log.Fatalf("Failed to get JSON schema: %v", err)
+		}
+
+		p.Extractor = ext
+		p.Model = config.ExtractionModel
+		p.Schema = jobSchema
 	}
 
-	if classify {
-		// TODO: A pre-processing step here to remove menus and other junk content
-		// would help the classifier.
+	if classify || classifyLinks {
+		// NOTE: the classifier works best on main content only, so menus and
+		// other junk content don't dilute it; see -clean-mode.
 
 		// Classify the content.
 		//
@@ -75,48 +240,113 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to create zero-shot classifier: %v", err)
 		}
+		p.Classifier = zs
+		p.Classify = classify
+	}
 
-		// TODO: this is a dirty hack to workaround the input token limit in the
-		// cybertron package (1024 tokens for the default model).
+	if listing {
+		l := pipeline.Listing{
+			Pagination: scraper.Pagination{
+				LinkSelector:   nextSelector,
+				URLTemplate:    pageTemplate,
+				ButtonSelector: nextButton,
+				MaxPages:       maxPages,
+			},
+			DetailSelector: detailSelector,
+			ExternalLinks:  externalLinks,
+			ClassifyLinks:  classifyLinks,
+			StripTemplates: stripTemplates,
+		}
+		if detailPattern != "" {
+			if l.DetailPattern, err = regexp.Compile(detailPattern); err != nil {
+				log.Fatalf("Invalid detail pattern: %v", err)
+			}
+		}
 
-		// Remove all empty lines and use half the content.
-		shortenedMarkdown := strings.Replace(markdown, "\n\n", "\n", -1)
-		shortenedMarkdown = strings.TrimSpace(shortenedMarkdown)
+		results, err := p.RunListing(context.Background(), url, l)
+		if err != nil {
+			log.Fatalf("Failed to process listing: %v", err)
+		}
+
+		records := make([]listingRecord, 0, len(results))
+		for _, r := range results {
+			records = append(records, newListingRecord(r, noExtract, outputFormat))
+		}
 
-		classificationResult, err := zs.Classify(
-			context.Background(),
-			shortenedMarkdown[:len(shortenedMarkdown)/2],
-			config.ClassificationLabels,
-		)
+		out, err := json.MarshalIndent(records, "", "  ")
 		if err != nil {
-			log.Fatalf("Failed to classify content: %v", err)
+			log.Fatalf("Failed to marshal results: %v", err)
 		}
 
-		fmt.Printf("Classification result: %v\n", classificationResult)
+		fmt.Println(string(out))
+		return
 	}
 
-	ext, err := extractor.NewExtractor(context.Background(), geminiAPIKey)
+	result, err := p.Run(context.Background(), url)
 	if err != nil {
-		log.Fatalf("Failed to create extractor: %v", err)
+		log.Fatalf("Failed to process URL: %v", err)
 	}
 
-	// Use a JSON schema to structure the extracted content.
-	jobSchema, err := schema.JSONSchemaString(schema.JobPosting{})
-	if err != nil {
-		log.Fatalf("Failed to get JSON schema: %v", err)
+	if result.Classification != nil {
+		fmt.Printf("Classification result: %v\n", result.Classification)
 	}
 
-	// Extract content.
-	extractedContent, err := ext.ExtractContent(
-		context.Background(),
-		config.ExtractionModel,
-		jobSchema,
-		url,
-		markdown,
-	)
-	if err != nil {
-		log.Fatalf("Failed to extract content: %v", err)
+	if result.CleaningReport != nil {
+		report, err := json.MarshalIndent(result.CleaningReport, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal cleaning report: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Cleaning report: %s\n", report)
+	}
+
+	if debug && result.NormalisationReport != nil {
+		report, err := json.MarshalIndent(result.NormalisationReport, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal normalisation report: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Normalisation report: %s\n", report)
+	}
+
+	if noExtract {
+		if result.Chunks != nil {
+			out, err := json.MarshalIndent(result.Chunks, "", "  ")
+			if err != nil {
+				log.Fatalf("Failed to marshal chunks: %v", err)
+			}
+			fmt.Println(string(out))
+			return
+		}
+		if outputFormat != converter.Markdown {
+			fmt.Println(result.Output)
+			return
+		}
+		fmt.Println(result.Markdown)
+		return
+	}
+
+	fmt.Println(result.Extracted)
+}
+
+// listingRecord is a listing result with the content printed for a single
+// page: the converted content with -no-extract, otherwise the extraction
+type listingRecord struct {
+	*pipeline.Result
+
+	Content   string `json:"content,omitempty"`
+	Extracted string `json:"extracted,omitempty"`
+}
+
+// newListingRecord returns the output record for a listing result
+func newListingRecord(r *pipeline.Result, noExtract bool, format converter.Format) listingRecord {
+	rec := listingRecord{Result: r}
+	switch {
+	case !noExtract:
+		rec.Extracted = r.Extracted
+	case format != converter.Markdown:
+		rec.Content = r.Output
+	default:
+		rec.Content = r.Markdown
 	}
 
-	fmt.Println(extractedContent)
+	return rec
 }
@@ -0,0 +1,270 @@
+// Package budget trims Markdown to fit a model token budget, removing the
+// lowest-value blocks first
+package budget
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+)
+
+// Tokenizer counts the model tokens in text.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// Estimator is a Tokenizer that estimates token counts from the length of
+// text in bytes, for models whose tokenizer is not available.
+type Estimator struct{}
+
+// CountTokens implements Tokenizer.
+func (Estimator) CountTokens(text string) int {
+	return (len(text) + config.BytesPerToken - 1) / config.BytesPerToken
+}
+
+// Block values, lowest first; blocks of lower value are dropped first
+const (
+	valueRepeated = iota
+	valueBoilerplate
+	valueLinks
+	valueText
+	valueHeading
+)
+
+var (
+	// imageRe matches Markdown images
+	imageRe = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+
+	// linkRe matches Markdown links, capturing their text
+	linkRe = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+)
+
+// block is a paragraph, list, table, code block or heading of Markdown
+type block struct {
+	text   string
+	value  int
+	tokens int
+	keep   bool
+}
+
+// Trim returns the Markdown cut to at most budget tokens. Blocks are kept
+// by value, then by position, so repeated blocks, boilerplate and link
+// lists go before the content. Kept blocks stay in their original order,
+// and text is only cut between words.
+func Trim(markdown string, tok Tokenizer, budget int) string {
+	if tok.CountTokens(markdown) <= budget {
+		return markdown
+	}
+
+	blocks := splitBlocks(markdown)
+	for i := range blocks {
+		blocks[i].tokens = tok.CountTokens(blocks[i].text)
+	}
+	separator := tok.CountTokens("\n\n")
+
+	order := make([]int, len(blocks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return blocks[order[i]].value > blocks[order[j]].value
+	})
+
+	// Keep the most valuable blocks while they fit, then fill what is left
+	// with the start of the next block if it is text
+	remaining := budget
+	for _, i := range order {
+		b := &blocks[i]
+		if b.tokens+separator <= remaining {
+			b.keep = true
+			remaining -= b.tokens + separator
+			continue
+		}
+
+		if b.value == valueText && remaining > separator {
+			if text := Truncate(b.text, tok, remaining-separator); text != "" {
+				b.text, b.keep = text, true
+			}
+		}
+		break
+	}
+
+	var kept []string
+	for _, b := range blocks {
+		if b.keep {
+			kept = append(kept, b.text)
+		}
+	}
+	trimmed := strings.Join(kept, "\n\n")
+
+	// Token counts are not always additive, so check the whole
+	if tok.CountTokens(trimmed) > budget {
+		trimmed = Truncate(trimmed, tok, budget)
+	}
+
+	return trimmed
+}
+
+// splitBlocks splits Markdown into blocks and values each block
+func splitBlocks(markdown string) []block {
+	seen := make(map[string]bool)
+	var blocks []block
+	for _, text := range SplitBlocks(markdown) {
+		blocks = append(blocks, block{text: text, value: blockValue(text, seen)})
+	}
+
+	return blocks
+}
+
+// SplitBlocks splits Markdown into blocks, such as paragraphs, lists and
+// headings, at blank lines, keeping fenced code blocks whole.
+func SplitBlocks(markdown string) []string {
+	var (
+		blocks  []string
+		current []string
+		fence   string
+	)
+	flush := func() {
+		if len(current) > 0 {
+			blocks = append(blocks, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		case trimmed == "":
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+
+	return blocks
+}
+
+// ParseHeading parses a heading block, returning its level and title. The
+// block is either a single line ATX heading, such as "## Requirements", or a
+// setext heading, underlined with "=" for level 1 or "-" for level 2.
+func ParseHeading(block string) (int, string, bool) {
+	lines := strings.Split(strings.TrimSpace(block), "\n")
+	switch len(lines) {
+	case 1:
+		line := lines[0]
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		if level == 0 || level > 6 || (len(line) > level && line[level] != ' ') {
+			return 0, "", false
+		}
+		return level, strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#")), true
+	case 2:
+		title, underline := strings.TrimSpace(lines[0]), strings.TrimSpace(lines[1])
+		switch {
+		case title == "":
+		case strings.Trim(underline, "=") == "":
+			return 1, title, true
+		case strings.Trim(underline, "-") == "":
+			return 2, title, true
+		}
+	}
+
+	return 0, "", false
+}
+
+// blockValue rates how much a block is worth keeping, recording its text
+// so later repeats are found
+func blockValue(text string, seen map[string]bool) int {
+	key := strings.ToLower(strings.Join(strings.Fields(text), " "))
+	if seen[key] {
+		return valueRepeated
+	}
+	seen[key] = true
+
+	if _, _, ok := ParseHeading(text); ok {
+		return valueHeading
+	}
+
+	return contentValue(text)
+}
+
+// Boilerplate reports whether a block looks like boilerplate, such as a
+// cookie notice or a list of links, rather than content.
+func Boilerplate(block string) bool {
+	if _, _, ok := ParseHeading(block); ok {
+		return false
+	}
+	v := contentValue(block)
+
+	return v == valueBoilerplate || v == valueLinks
+}
+
+// contentValue rates a block that is not a heading by how much of it is
+// content
+func contentValue(text string) int {
+	// Judge the block by the text a reader sees
+	visible := imageRe.ReplaceAllString(text, "")
+	linked := linkRe.FindAllStringSubmatch(visible, -1)
+	visible = linkRe.ReplaceAllString(visible, "$1")
+	words := strings.FieldsFunc(visible, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return valueLinks
+	}
+
+	lower := strings.ToLower(visible)
+	if len(words) <= config.BudgetBoilerplateMaxWords {
+		for _, phrase := range config.BudgetBoilerplatePhrases {
+			if strings.Contains(lower, phrase) {
+				return valueBoilerplate
+			}
+		}
+	}
+
+	var linkText int
+	for _, m := range linked {
+		linkText += len(strings.TrimSpace(m[1]))
+	}
+	if float64(linkText) > config.BudgetMaxLinkDensity*float64(len(strings.TrimSpace(visible))) {
+		return valueLinks
+	}
+
+	return valueText
+}
+
+// Truncate returns the longest prefix of text, ending at a word boundary,
+// that fits in budget tokens. It is empty if the first word does not fit.
+func Truncate(text string, tok Tokenizer, budget int) string {
+	// Candidate cuts are the ends of words, which are never within a rune
+	var ends []int
+	inWord := false
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if space && inWord {
+			ends = append(ends, i)
+		}
+		inWord = !space
+	}
+	if inWord {
+		ends = append(ends, len(text))
+	}
+
+	n := sort.Search(len(ends), func(i int) bool {
+		return tok.CountTokens(text[:ends[i]]) > budget
+	})
+	if n == 0 {
+		return ""
+	}
+
+	return text[:ends[n-1]]
+}
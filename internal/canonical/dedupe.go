@@ -0,0 +1,70 @@
+package canonical
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+)
+
+// Deduper tracks canonical URLs and content hashes that have already been
+// seen, so the same page is only processed once. It is safe for concurrent use.
+type Deduper struct {
+	mu     sync.Mutex
+	urls   map[string]struct{}
+	hashes map[string]string
+}
+
+// NewDeduper creates a new, empty Deduper.
+func NewDeduper() *Deduper {
+	return &Deduper{
+		urls:   make(map[string]struct{}),
+		hashes: make(map[string]string),
+	}
+}
+
+// SeenURL records the canonical form of the given URL and reports whether it
+// had already been recorded.
+func (d *Deduper) SeenURL(rawURL string) (bool, error) {
+	u, err := URL(rawURL)
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.urls[u]; ok {
+		return true, nil
+	}
+	d.urls[u] = struct{}{}
+
+	return false, nil
+}
+
+// SeenContent records the hash of the given content against the URL it was
+// fetched from. If identical content was already recorded, the URL it was
+// first seen at is returned along with true.
+func (d *Deduper) SeenContent(url, content string) (string, bool) {
+	hash := ContentHash(content)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if first, ok := d.hashes[hash]; ok {
+		return first, true
+	}
+	d.hashes[hash] = url
+
+	return "", false
+}
+
+// ContentHash returns a hex encoded SHA-256 hash of the content with
+// whitespace and letter case normalised, so trivial formatting differences
+// do not defeat duplicate detection.
+func ContentHash(content string) string {
+	normalised := strings.ToLower(strings.Join(strings.Fields(content), " "))
+	sum := sha256.Sum256([]byte(normalised))
+
+	return hex.EncodeToString(sum[:])
+}
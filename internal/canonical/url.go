@@ -0,0 +1,122 @@
+// Package canonical provides URL canonicalisation and duplicate detection for batch and crawl modes
+package canonical
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"golang.org/x/net/html"
+)
+
+// URL returns the canonical form of a URL.
+//
+// The scheme and host are lowercased, default ports and fragments are removed,
+// tracking parameters are dropped and the remaining query parameters are sorted.
+func URL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("URL must be absolute: %q", rawURL)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+
+	// Strip default ports
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+
+	// Fragments never change the content served
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	// Drop tracking parameters; Encode sorts the remaining keys
+	query := u.Query()
+	for key := range query {
+		if isTrackingParam(key) {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// FromHTML returns the canonical URL of a page, preferring the rel=canonical
+// link in the document over the URL the page was fetched from.
+func FromHTML(pageURL, rawHTML string) (string, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse page URL: %w", err)
+	}
+
+	doc, err := html.Parse(strings.NewReader(rawHTML))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	if href := findCanonicalLink(doc); href != "" {
+		ref, err := url.Parse(href)
+		if err == nil {
+			resolved := base.ResolveReference(ref)
+			if resolved.Scheme == "http" || resolved.Scheme == "https" {
+				return URL(resolved.String())
+			}
+		}
+	}
+
+	return URL(pageURL)
+}
+
+// findCanonicalLink returns the href of the first link element with rel=canonical
+func findCanonicalLink(n *html.Node) string {
+	if n.Type == html.ElementNode && n.Data == "link" {
+		var rel, href string
+		for _, attr := range n.Attr {
+			switch attr.Key {
+			case "rel":
+				rel = attr.Val
+			case "href":
+				href = attr.Val
+			}
+		}
+		for _, r := range strings.Fields(rel) {
+			if strings.EqualFold(r, "canonical") && strings.TrimSpace(href) != "" {
+				return strings.TrimSpace(href)
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if href := findCanonicalLink(c); href != "" {
+			return href
+		}
+	}
+
+	return ""
+}
+
+// isTrackingParam reports whether a query parameter is used only for tracking
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if config.TrackingParams[key] {
+		return true
+	}
+	for _, prefix := range config.TrackingParamPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/danmrichards/sandbox/toyscraper/internal/budget"
 	"github.com/nlpodyssey/cybertron/pkg/tasks"
 	"github.com/nlpodyssey/cybertron/pkg/tasks/zeroshotclassifier"
+	"github.com/nlpodyssey/cybertron/pkg/tasks/zeroshotclassifier/bart"
 )
 
 // ZeroShot is a struct that holds the Zero-Shot Classifier model.
@@ -38,3 +40,16 @@ func (z *ZeroShot) Classify(ctx context.Context, text string, labels []string) (
 
 	return &result, nil
 }
+
+// CountTokens counts the tokens in text with the tokenizer of the model, so
+// input can be trimmed to the model's limit. Text the tokenizer cannot
+// encode, and models without a known tokenizer, fall back to an estimate.
+func (z *ZeroShot) CountTokens(text string) int {
+	if m, ok := z.model.(*bart.ZeroShotClassifier); ok && m.Tokenizer != nil {
+		if encoded, err := m.Tokenizer.Encode(text); err == nil {
+			return len(encoded.IDs)
+		}
+	}
+
+	return budget.Estimator{}.CountTokens(text)
+}
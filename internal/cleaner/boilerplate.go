@@ -0,0 +1,202 @@
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"golang.org/x/net/html"
+)
+
+// Boilerplate selects how aggressively boilerplate blocks are removed.
+type Boilerplate int
+
+const (
+	// BoilerplateOff keeps boilerplate blocks
+	BoilerplateOff Boilerplate = iota
+
+	// BoilerplateLandmarks removes landmark elements and ARIA roles such as
+	// nav, header, footer and aside
+	BoilerplateLandmarks
+
+	// BoilerplateAggressive also removes blocks whose class or id names look
+	// like menus, breadcrumbs, cookie banners and similar
+	BoilerplateAggressive
+)
+
+// ParseBoilerplate parses a boilerplate level name, as used on the command line.
+func ParseBoilerplate(name string) (Boilerplate, error) {
+	switch name {
+	case "off", "":
+		return BoilerplateOff, nil
+	case "landmarks":
+		return BoilerplateLandmarks, nil
+	case "aggressive":
+		return BoilerplateAggressive, nil
+	default:
+		return BoilerplateOff, fmt.Errorf("unknown boilerplate level %q (want off, landmarks or aggressive)", name)
+	}
+}
+
+// sectioningElements scope header and footer elements to a section rather
+// than the page, so they are not boilerplate
+var sectioningElements = map[string]bool{
+	"article": true,
+	"aside":   true,
+	"main":    true,
+	"nav":     true,
+	"section": true,
+}
+
+// boilerplateRemover removes boilerplate blocks that are not preserved
+type boilerplateRemover struct {
+	level           Boilerplate
+	preserve        cascadia.SelectorGroup
+	preserveContact bool
+	patterns        []string
+	report          *Report
+}
+
+// newBoilerplateRemover compiles the preserve selectors from the options
+func newBoilerplateRemover(opts Options, report *Report) (*boilerplateRemover, error) {
+	preserve, err := parseSelectors(opts.Preserve)
+	if err != nil {
+		return nil, fmt.Errorf("preserve: %w", err)
+	}
+
+	return &boilerplateRemover{
+		level:           opts.Boilerplate,
+		preserve:        preserve,
+		preserveContact: opts.PreserveContact,
+		patterns:        append(append([]string(nil), config.BoilerplatePatterns...), config.LanguageBoilerplatePatterns[opts.Language]...),
+		report:          report,
+	}, nil
+}
+
+// remove removes boilerplate blocks from the subtree
+func (r *boilerplateRemover) remove(n *html.Node) {
+	var next *html.Node
+	for c := n.FirstChild; c != nil; c = next {
+		next = c.NextSibling
+
+		if c.Type == html.ElementNode && r.isBoilerplate(c) && !r.isPreserved(c) {
+			r.report.removed(ruleBoilerplate, c)
+			n.RemoveChild(c)
+			continue
+		}
+		r.remove(c)
+	}
+}
+
+// isBoilerplate reports whether an element is boilerplate at the configured level
+func (r *boilerplateRemover) isBoilerplate(n *html.Node) bool {
+	if r.level == BoilerplateOff {
+		return false
+	}
+
+	switch n.Data {
+	case "html", "body", "main":
+		return false
+	case "header", "footer":
+		if !inSection(n) {
+			return true
+		}
+	default:
+		if config.BoilerplateTags[n.Data] {
+			return true
+		}
+	}
+	if config.BoilerplateRoles[getAttr(n, "role")] {
+		return true
+	}
+
+	if r.level < BoilerplateAggressive {
+		return false
+	}
+
+	// Wrappers around the main content often carry menu state classes
+	if containsMainLandmark(n) {
+		return false
+	}
+
+	return matchesBoilerplatePattern(getAttr(n, "class")+" "+getAttr(n, "id"), r.patterns)
+}
+
+// isPreserved reports whether an element, or anything within it, matches a
+// preserve selector or holds contact details
+func (r *boilerplateRemover) isPreserved(n *html.Node) bool {
+	if len(r.preserve) > 0 && (r.preserve.Match(n) || cascadia.Query(n, r.preserve) != nil) {
+		return true
+	}
+
+	return r.preserveContact && hasContactInfo(n)
+}
+
+// hasContactInfo reports whether the subtree holds an address element or an
+// email or telephone link
+func hasContactInfo(n *html.Node) bool {
+	if n.Type == html.ElementNode {
+		if n.Data == "address" {
+			return true
+		}
+		if n.Data == "a" {
+			href := getAttr(n, "href")
+			if strings.HasPrefix(href, "mailto:") || strings.HasPrefix(href, "tel:") {
+				return true
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if hasContactInfo(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesBoilerplatePattern reports whether any word in the class and id
+// names starts with one of the boilerplate patterns
+func matchesBoilerplatePattern(classAndID string, patterns []string) bool {
+	words := strings.FieldsFunc(classAndID, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, w := range words {
+		for _, pattern := range patterns {
+			if strings.HasPrefix(w, pattern) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// inSection reports whether an element is within sectioning content
+func inSection(n *html.Node) bool {
+	for a := n.Parent; a != nil; a = a.Parent {
+		if a.Type == html.ElementNode && (sectioningElements[a.Data] || getAttr(a, "role") == "main") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsMainLandmark reports whether the subtree holds the main content landmark
+func containsMainLandmark(n *html.Node) bool {
+	if n.Type == html.ElementNode && (n.Data == "main" || getAttr(n, "role") == "main") {
+		return true
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if containsMainLandmark(c) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -7,38 +7,281 @@ import (
 	"strings"
 
 	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"github.com/danmrichards/sandbox/toyscraper/internal/language"
 	"golang.org/x/net/html"
 )
 
+// Mode selects how much of a page is kept during cleaning.
+type Mode int
+
+const (
+	// FullPage keeps all content that survives cleaning
+	FullPage Mode = iota
+
+	// MainContent keeps only the primary content of the page, found by
+	// scoring blocks on text density, link density and semantic tags
+	MainContent
+)
+
+// ParseMode parses a cleaning mode name, as used on the command line.
+func ParseMode(name string) (Mode, error) {
+	switch name {
+	case "full", "":
+		return FullPage, nil
+	case "main":
+		return MainContent, nil
+	default:
+		return FullPage, fmt.Errorf("unknown cleaning mode %q (want full or main)", name)
+	}
+}
+
+// Options configures cleaning. The zero value cleans the full page.
+type Options struct {
+	Mode Mode
+
+	// Boilerplate sets how aggressively boilerplate blocks are removed
+	Boilerplate Boilerplate
+
+	// Preserve lists CSS selectors for blocks that are never removed as
+	// boilerplate, nor are blocks containing them
+	Preserve []string
+
+	// PreserveContact keeps boilerplate blocks, such as footers, that hold
+	// contact details
+	PreserveContact bool
+
+	// BaseURL is the final URL of the page, used with any base element to
+	// make link and image URLs absolute
+	BaseURL string
+
+	// SpecialLinks sets how javascript:, mailto: and tel: links are handled
+	SpecialLinks SpecialLinks
+
+	// Images sets how images are handled
+	Images Images
+
+	// Forms sets how forms and their controls are handled
+	Forms Forms
+
+	// KeepHidden keeps elements the scraper marked as not visible in the
+	// rendered page
+	KeepHidden bool
+
+	// Profile holds user-supplied selector and attribute rules, applied
+	// according to the host of BaseURL
+	Profile *Profile
+
+	// Language is the language of the page, as an ISO 639-1 code, used to
+	// choose language-specific boilerplate patterns. It is detected from
+	// the page text and lang attribute if empty.
+	Language string
+
+	// Report enables a report on what cleaning removed
+	Report bool
+
+	// Template strips the blocks repeated across the pages of the site of
+	// BaseURL. Pages cleaned as a stream are not stripped.
+	Template *Template
+}
+
+// Result is the output of cleaning a page.
+type Result struct {
+	// HTML is the cleaned HTML content
+	HTML string
+
+	// StructuredData is the JSON-LD, microdata and RDFa found in the page
+	// before cleaning
+	StructuredData *StructuredData
+
+	// Metadata is the page information found in the document head before
+	// cleaning
+	Metadata *Metadata
+
+	// Language is the language of the page, as an ISO 639-1 code, or empty
+	// if it could not be determined
+	Language string
+
+	// Report describes what cleaning removed, if enabled in the options
+	Report *Report
+}
+
 // HTML sanitizes and optimizes HTML for content extraction
 func HTML(rawHTML string) (string, error) {
-	// Check content length
+	res, err := Clean(rawHTML, Options{})
+	if err != nil {
+		return "", err
+	}
+
+	return res.HTML, nil
+}
+
+// Clean sanitizes and optimizes HTML for content extraction using the given options
+func Clean(rawHTML string, opts Options) (*Result, error) {
+	// Content too large to parse as a tree is cut down as a stream first
 	if len(rawHTML) > config.MaxContentLength {
-		return "", fmt.Errorf("HTML content exceeds maximum allowed length (%d bytes)", config.MaxContentLength)
+		return cleanStream(rawHTML, opts)
 	}
 
 	// Parse HTML
 	doc, err := html.Parse(strings.NewReader(rawHTML))
 	if err != nil {
-		return "", fmt.Errorf("failed to parse HTML: %v", err)
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	// Capture structured data and metadata before the scripts and head
+	// holding them are stripped
+	res := &Result{
+		StructuredData: extractStructuredData(doc),
+		Metadata:       extractMetadata(doc),
+	}
+	if res.Metadata.Logo == "" {
+		res.Metadata.Logo = detectLogo(doc)
 	}
 
+	// Detect the language before any text is removed
+	if opts.Language == "" {
+		opts.Language = language.Choose(res.Metadata.Lang, visibleText(doc))
+	}
+	res.Language = opts.Language
+	if opts.Report {
+		res.Report = newReport()
+	}
+
+	// Remove blocks repeated across the pages of the site
+	opts.Template.strip(doc, opts.BaseURL, res.Report)
+
+	// Remove elements that were not visible in the rendered page
+	if !opts.KeepHidden {
+		removeHidden(doc, res.Report)
+	}
+
+	// Apply the profile rules for this page
+	rules, err := compileProfile(opts.Profile.ForURL(opts.BaseURL))
+	if err != nil {
+		return nil, err
+	}
+	rules.apply(doc, res.Report)
+
+	// Summarise or drop forms, keeping the action of any application form
+	// as a candidate application link
+	if form := handleForms(doc, opts.Forms, res.Report); form != nil {
+		res.Metadata.ApplicationURL = rawAttr(form, "action")
+		if res.Metadata.ApplicationURL == "" {
+			res.Metadata.ApplicationURL = opts.BaseURL
+		}
+	}
+
+	// Remove boilerplate blocks; this relies on the class, id and role
+	// attributes that cleaning strips
+	remover, err := newBoilerplateRemover(opts, res.Report)
+	if err != nil {
+		return nil, err
+	}
+	remover.remove(doc)
+
+	// Keep only the primary content; this relies on the class, id and role
+	// attributes that cleaning strips
+	if opts.Mode == MainContent {
+		extractMainContent(doc, res.Report)
+	}
+
+	// Unwrap layout tables and normalise data tables and definition lists;
+	// this relies on the role and span attributes that cleaning strips
+	normaliseTables(doc)
+
+	// Make URLs absolute, including those in the metadata
+	resolver, err := newLinkResolver(doc, opts, res.Report)
+	if err != nil {
+		return nil, err
+	}
+	resolver.resolve(doc)
+	res.Metadata.resolve(resolver)
+
 	// Clean the HTML tree
-	cleanNode(doc)
+	cleanNode(doc, rules.keepAttributes, opts.Images, res.Report)
 
 	// Remove empty elements
-	removeEmptyNodes(doc)
+	removeEmptyNodes(doc, res.Report)
+
+	if res.HTML, err = render(doc); err != nil {
+		return nil, err
+	}
+	res.Report.finish(len(rawHTML), len(res.HTML))
+
+	return res, nil
+}
+
+// cleanStream cleans HTML too large to parse as a tree, without structured
+// data or metadata. Scripts, styles, hidden elements and attributes are
+// removed as a stream, then what is left is parsed as a tree to normalise
+// tables and remove empty elements, so the output matches Clean. Memory use
+// is bounded by the page and its cleaned HTML, which are both held, and the
+// tree of the cleaned HTML, which conversion builds anyway.
+func cleanStream(rawHTML string, opts Options) (*Result, error) {
+	var sb strings.Builder
+	report, err := stream(&sb, strings.NewReader(rawHTML), opts, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clean HTML as a stream: %w", err)
+	}
+
+	doc, err := html.Parse(strings.NewReader(sb.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+	rules, err := compileProfile(opts.Profile.ForURL(opts.BaseURL))
+	if err != nil {
+		return nil, err
+	}
+
+	normaliseTables(doc)
+	stripAttributes(doc, rules.keepAttributes, report)
+	removeEmptyNodes(doc, report)
+
+	res := &Result{Language: opts.Language, Report: report}
+	if res.HTML, err = render(doc); err != nil {
+		return nil, err
+	}
+	report.finish(len(rawHTML), len(res.HTML))
+
+	return res, nil
+}
+
+// render renders a cleaned document without its empty lines. Whitespace
+// directly within the html element is dropped, as parsing drops it before
+// an implied head, so streamed and tree cleaned pages match.
+func render(doc *html.Node) (string, error) {
+	for n := doc.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type != html.ElementNode || n.Data != "html" {
+			continue
+		}
+		var next *html.Node
+		for c := n.FirstChild; c != nil; c = next {
+			next = c.NextSibling
+			if c.Type == html.TextNode && strings.TrimSpace(c.Data) == "" {
+				n.RemoveChild(c)
+			}
+		}
+	}
 
-	// Render the cleaned HTML
 	var buf bytes.Buffer
 	if err := html.Render(&buf, doc); err != nil {
 		return "", fmt.Errorf("failed to render HTML: %v", err)
 	}
 
-	// Remove empty lines and normalize whitespace
 	return removeEmptyLines(buf.String()), nil
 }
 
+// stripAttributes removes the attributes not kept from every element in
+// the subtree
+func stripAttributes(n *html.Node, keepAttrs map[string]bool, report *Report) {
+	if n.Type == html.ElementNode {
+		cleanAttributes(n, keepAttrs, report)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		stripAttributes(c, keepAttrs, report)
+	}
+}
+
 // removeEmptyLines removes consecutive empty lines from HTML content
 func removeEmptyLines(content string) string {
 	// Split content into lines
@@ -63,28 +306,27 @@ func removeEmptyLines(content string) string {
 	return strings.Join(result, "\n")
 }
 
-// cleanNode recursively cleans an HTML node and its children
-func cleanNode(n *html.Node) {
-	// Process children first (before potentially removing them)
-	var next *html.Node
-	for c := n.FirstChild; c != nil; c = next {
-		next = c.NextSibling
-		cleanNode(c)
-	}
-
+// cleanNode recursively cleans an HTML node and its children, keeping only
+// the given attributes and handling images in the given mode
+func cleanNode(n *html.Node, keepAttrs map[string]bool, images Images, report *Report) {
 	// Remove comment nodes
 	if n.Type == html.CommentNode {
+		report.removed(ruleComment, n)
 		removeNode(n)
 		return
 	}
 
-	// Skip if not an element node
-	if n.Type != html.ElementNode {
+	// Normalise text content
+	if n.Type == html.TextNode {
+		n.Data = normaliseText(n.Data)
 		return
 	}
 
-	// Check if this is an unwanted element
-	if config.UnwantedElements[n.Data] {
+	// Check if this is an unwanted element, before cleaning content that
+	// is removed with it
+	if n.Type == html.ElementNode && config.UnwantedElements[n.Data] {
+		report.removed(ruleUnwanted, n)
+
 		// If this is the root node, just remove all its children
 		if n.Parent == nil {
 			n.FirstChild = nil
@@ -96,13 +338,68 @@ func cleanNode(n *html.Node) {
 		return
 	}
 
+	// Process children (before potentially removing them)
+	var next *html.Node
+	for c := n.FirstChild; c != nil; c = next {
+		next = c.NextSibling
+		cleanNode(c, keepAttrs, images, report)
+	}
+
+	// Skip if not an element node
+	if n.Type != html.ElementNode {
+		return
+	}
+
 	// Process images and other media
-	if n.Data == "img" {
-		processImageNode(n)
+	if n.Data == "img" && !processImageNode(n, images, report) {
+		return
 	}
 
 	// Remove unwanted attributes
-	cleanAttributes(n)
+	cleanAttributes(n, keepAttrs, report)
+}
+
+// visibleText returns the text of a document outside unwanted and hidden
+// elements, up to the length used for language detection
+func visibleText(doc *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if sb.Len() >= config.LanguageSampleLength {
+			return
+		}
+		switch n.Type {
+		case html.TextNode:
+			sb.WriteString(n.Data)
+			sb.WriteString(" ")
+			return
+		case html.ElementNode:
+			if config.UnwantedElements[n.Data] || hasAttr(n, config.HiddenMarkerAttribute) {
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return sb.String()
+}
+
+// removeHidden removes elements marked as hidden by the scraper
+func removeHidden(n *html.Node, report *Report) {
+	var next *html.Node
+	for c := n.FirstChild; c != nil; c = next {
+		next = c.NextSibling
+
+		if c.Type == html.ElementNode && hasAttr(c, config.HiddenMarkerAttribute) {
+			report.removed(ruleHidden, c)
+			n.RemoveChild(c)
+			continue
+		}
+		removeHidden(c, report)
+	}
 }
 
 // removeNode removes a node from its parent
@@ -126,59 +423,76 @@ func removeNode(n *html.Node) {
 }
 
 // cleanAttributes removes unwanted attributes from a node
-func cleanAttributes(n *html.Node) {
-	// Build a new attribute list with only the attributes we want to keep
-	var newAttrs []html.Attribute
-	for _, attr := range n.Attr {
-		if config.KeepAttributes[attr.Key] {
-			newAttrs = append(newAttrs, attr)
-		}
-	}
-	n.Attr = newAttrs
+func cleanAttributes(n *html.Node, keepAttrs map[string]bool, report *Report) {
+	n.Attr = filterAttributes(n.Attr, keepAttrs, report)
 }
 
-// processImageNode processes an image node, replacing it with its alt text if available
-func processImageNode(n *html.Node) {
-	var alt string
-	for _, attr := range n.Attr {
-		if attr.Key == "alt" && attr.Val != "" {
-			alt = attr.Val
-			break
+// filterAttributes returns only the attributes we want to keep, with their
+// text values normalised
+func filterAttributes(attrs []html.Attribute, keepAttrs map[string]bool, report *Report) []html.Attribute {
+	var newAttrs []html.Attribute
+	for _, attr := range attrs {
+		if !keepAttrs[attr.Key] {
+			report.removedAttribute(attr.Key)
+			continue
 		}
+		if attr.Key == "alt" || attr.Key == "title" {
+			attr.Val = normaliseText(attr.Val)
+		}
+		newAttrs = append(newAttrs, attr)
 	}
 
-	// If there's alt text, keep the image but ensure it's marked
-	if alt != "" {
-		// Keep the alt attribute as is
-		return
-	}
+	return newAttrs
+}
 
-	// No useful alt text, remove the image
-	removeNode(n)
+// keptEmptyElements are not removed even if empty, as they are content
+// themselves; table cells keep the columns of their table aligned
+var keptEmptyElements = map[string]bool{
+	"br":       true,
+	"hr":       true,
+	"img":      true,
+	"td":       true,
+	"th":       true,
+	"input":    true,
+	"select":   true,
+	"textarea": true,
+	"video":    true,
+	"audio":    true,
 }
 
-// removeEmptyNodes removes nodes with no content
-func removeEmptyNodes(n *html.Node) bool {
-	if n.Type == html.TextNode {
+// removeEmptyNodes removes elements with no content, reporting whether the
+// node has any. Whitespace is not content, but is kept in the tree, as it
+// separates the words of neighbouring inline elements.
+func removeEmptyNodes(n *html.Node, report *Report) bool {
+	switch n.Type {
+	case html.TextNode:
 		return len(strings.TrimSpace(n.Data)) > 0
-	}
-
-	if n.Type != html.ElementNode {
-		return false
-	}
-
-	// Elements that shouldn't be removed even if empty
-	if n.Data == "br" || n.Data == "hr" || n.Data == "img" {
+	case html.DoctypeNode:
 		return true
+	case html.ElementNode:
+		if keptEmptyElements[n.Data] {
+			return true
+		}
+	case html.DocumentNode:
+		// The document is walked but never removed itself
+	default:
+		return false
 	}
 
 	hasContent := false
 	var next *html.Node
 	for c := n.FirstChild; c != nil; c = next {
 		next = c.NextSibling
-		if removeEmptyNodes(c) {
+		switch {
+		case removeEmptyNodes(c, report):
 			hasContent = true
-		} else {
+		case c.Type == html.TextNode:
+		default:
+			// Elements holding only whitespace leave a space in their place
+			if c.Type == html.ElementNode && textContent(c) != "" {
+				n.InsertBefore(&html.Node{Type: html.TextNode, Data: " "}, c)
+			}
+			report.removed(ruleEmpty, c)
 			removeNode(c)
 		}
 	}
@@ -0,0 +1,148 @@
+package cleaner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/converter"
+)
+
+func TestCleanRemovesEmptyElements(t *testing.T) {
+	raw := `<!DOCTYPE html><html><body>
+<div><span> </span></div>
+<p>Salary</p>
+<p></p>
+<table>
+<tr><th>Role</th><th>Location</th><th>Salary</th></tr>
+<tr><td>Engineer</td><td></td><td>£50,000</td></tr>
+</table>
+<form><label>Email <input type="email" name="email"></label></form>
+</body></html>`
+
+	res, err := Clean(raw, Options{})
+	if err != nil {
+		t.Fatalf("Clean: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		tag  string
+		want int
+	}{
+		{name: "empty paragraph removed", tag: "<p>", want: 1},
+		{name: "empty div removed", tag: "<div>", want: 0},
+		{name: "empty span removed", tag: "<span>", want: 0},
+		{name: "empty cell kept", tag: "<td>", want: 3},
+		{name: "header cells kept", tag: "<th>", want: 3},
+		{name: "input kept", tag: "<input", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Count(res.HTML, tt.tag); got != tt.want {
+				t.Errorf("got %d %s, want %d in:\n%s", got, tt.tag, tt.want, res.HTML)
+			}
+		})
+	}
+	if !strings.HasPrefix(res.HTML, "<!DOCTYPE html>") {
+		t.Errorf("doctype removed:\n%s", res.HTML)
+	}
+}
+
+func TestCleanKeepsSpacesBetweenInlineElements(t *testing.T) {
+	raw := `<html><body>
+<p><span>Jane</span> <span>Doe</span></p>
+<p><b>Salary:</b> <i>£50,000</i></p>
+<p>Contact<span> </span><a href="mailto:jobs@example.com">us</a></p>
+<pre>a  b
+  c</pre>
+</body></html>`
+
+	res, err := Clean(raw, Options{})
+	if err != nil {
+		t.Fatalf("Clean: %v", err)
+	}
+
+	for _, want := range []string{
+		"<span>Jane</span> <span>Doe</span>",
+		"<b>Salary:</b> <i>£50,000</i>",
+		"Contact <a",
+		"<pre>a  b\n  c</pre>",
+	} {
+		if !strings.Contains(res.HTML, want) {
+			t.Errorf("missing %q in:\n%s", want, res.HTML)
+		}
+	}
+
+	markdown, err := converter.ToMarkdown(res.HTML, converter.Options{})
+	if err != nil {
+		t.Fatalf("ToMarkdown: %v", err)
+	}
+	text, err := converter.ToText(res.HTML)
+	if err != nil {
+		t.Fatalf("ToText: %v", err)
+	}
+	for _, tt := range []struct{ format, output, want string }{
+		{"markdown", markdown, "Jane Doe"},
+		{"markdown", markdown, "**Salary:** _£50,000_"},
+		{"text", text, "Jane Doe"},
+		{"text", text, "Salary: £50,000"},
+		{"text", text, "Contact us"},
+	} {
+		if !strings.Contains(tt.output, tt.want) {
+			t.Errorf("missing %q in %s:\n%s", tt.want, tt.format, tt.output)
+		}
+	}
+}
+
+func TestCleanStreamMatchesTree(t *testing.T) {
+	raw := `<!DOCTYPE html>
+<html lang="en"><head><base href="https://example.com/jobs/"><title>Engineer</title><script>var x = 1;</script></head>
+<body class="page">
+<!-- comment -->
+<div data-toyscraper-hidden="true">Hidden</div>
+<h1>Software Engineer</h1>
+<p><span>Jane</span> <span>Doe</span> is hiring. See <a href="details" class="x">details</a>.</p>
+<p></p>
+<ul>
+  <li>Go</li>
+  <li>SQL</li>
+</ul>
+<dl><dt>Location</dt><dd>Remote</dd></dl>
+<table role="presentation"><tr><td><p>Layout cell</p></td></tr></table>
+<table>
+<tr><th>Role</th><th colspan="2">Pay</th></tr>
+<tr><td>Engineer</td><td>£50k</td><td></td></tr>
+</table>
+<form action="apply"><label>Email <input type="email" name="email"></label></form>
+<pre>a  b
+  c</pre>
+<img src="/logo.png" alt="Acme">
+</body></html>`
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "defaults"},
+		{name: "forms dropped", opts: Options{Forms: DropForms}},
+		{name: "images dropped", opts: Options{Images: DropImages}},
+		{name: "hidden kept", opts: Options{KeepHidden: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := Clean(raw, tt.opts)
+			if err != nil {
+				t.Fatalf("Clean: %v", err)
+			}
+			opts := tt.opts
+			opts.Language = tree.Language
+			streamed, err := cleanStream(raw, opts)
+			if err != nil {
+				t.Fatalf("cleanStream: %v", err)
+			}
+			if streamed.HTML != tree.HTML {
+				t.Errorf("stream output differs from tree output\ntree:\n%s\nstream:\n%s", tree.HTML, streamed.HTML)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package cleaner
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// textReplacer replaces non-breaking spaces with regular spaces and removes
+// invisible characters that break matching of job titles and salaries
+var textReplacer = strings.NewReplacer(
+	// Non-breaking and fixed-width spaces
+	"\u00a0", " ",
+	"\u2007", " ",
+	"\u202f", " ",
+
+	// Zero-width spaces, word joiners and byte order marks
+	"\u200b", "",
+	"\u2060", "",
+	"\ufeff", "",
+
+	// Soft hyphens, common in long German and Dutch compounds
+	"\u00ad", "",
+)
+
+// normaliseText applies NFC normalisation to text and replaces or removes
+// whitespace and invisible characters that render identically
+func normaliseText(s string) string {
+	return textReplacer.Replace(norm.NFC.String(s))
+}
@@ -0,0 +1,238 @@
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Forms selects how forms and their controls are handled.
+type Forms int
+
+const (
+	// KeepForms keeps forms and their controls as they are
+	KeepForms Forms = iota
+
+	// SummariseForms replaces each form with a sentence naming its purpose
+	// and fields, and removes controls outside forms
+	SummariseForms
+
+	// DropForms removes forms and controls outside forms
+	DropForms
+)
+
+// ParseForms parses a form handling name, as used on the command line.
+func ParseForms(name string) (Forms, error) {
+	switch name {
+	case "keep", "":
+		return KeepForms, nil
+	case "summarise", "summarize":
+		return SummariseForms, nil
+	case "drop":
+		return DropForms, nil
+	default:
+		return KeepForms, fmt.Errorf("unknown form handling %q (want keep, summarise or drop)", name)
+	}
+}
+
+// formControls are the elements a form is filled in with
+var formControls = map[string]bool{
+	"input":    true,
+	"select":   true,
+	"textarea": true,
+}
+
+// ignoredInputs are input types that are not fields a person fills in
+var ignoredInputs = map[string]bool{
+	"hidden": true,
+	"submit": true,
+	"button": true,
+	"reset":  true,
+	"image":  true,
+}
+
+// applicationWords mark the action, id or class of a job application form
+var applicationWords = []string{"apply", "application", "candidate"}
+
+// handleForms summarises or drops the forms in a document, returning the
+// first form that looks like a job application, if any. Forms are found
+// whatever the mode, so the application link is captured either way.
+func handleForms(doc *html.Node, mode Forms, report *Report) *html.Node {
+	var application *html.Node
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		var next *html.Node
+		for c := n.FirstChild; c != nil; c = next {
+			next = c.NextSibling
+			if c.Type != html.ElementNode {
+				continue
+			}
+
+			switch {
+			case c.Data == "form":
+				kind := formKind(c)
+				if application == nil && kind == "Application form" && !isSpecialLink(getAttr(c, "action")) {
+					application = c
+				}
+				if mode == KeepForms {
+					walk(c)
+					continue
+				}
+
+				report.removed(ruleForm, c)
+				if mode == SummariseForms {
+					p := element("p")
+					p.AppendChild(&html.Node{Type: html.TextNode, Data: formSummary(kind, formFields(c))})
+					n.InsertBefore(p, c)
+				}
+				n.RemoveChild(c)
+			case mode != KeepForms && formControls[c.Data]:
+				report.removed(ruleForm, c)
+				n.RemoveChild(c)
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(doc)
+
+	return application
+}
+
+// formKind names what a form is for, from its controls and attributes
+func formKind(form *html.Node) string {
+	names := getAttr(form, "action") + " " + getAttr(form, "id") + " " + getAttr(form, "class")
+	for _, word := range applicationWords {
+		if strings.Contains(names, word) {
+			return "Application form"
+		}
+	}
+
+	var upload, search bool
+	walkElements(form, func(n *html.Node) {
+		if n.Data != "input" {
+			return
+		}
+		switch getAttr(n, "type") {
+		case "file":
+			upload = true
+		case "search":
+			search = true
+		}
+	})
+
+	switch {
+	case upload:
+		return "Application form"
+	case search || getAttr(form, "role") == "search" || strings.Contains(names, "search"):
+		return "Search form"
+	default:
+		return "Form"
+	}
+}
+
+// formFields returns the names of the fields of a form, each once, using
+// their labels where possible
+func formFields(form *html.Node) []string {
+	// Labels are matched to controls by id, or by holding them
+	labels := make(map[string]string)
+	walkElements(form, func(n *html.Node) {
+		if n.Data == "label" && hasAttr(n, "for") {
+			labels[rawAttr(n, "for")] = labelText(n)
+		}
+	})
+
+	var fields []string
+	seen := make(map[string]bool)
+	walkElements(form, func(n *html.Node) {
+		if !formControls[n.Data] {
+			return
+		}
+		typ := getAttr(n, "type")
+		if n.Data == "input" && ignoredInputs[typ] {
+			return
+		}
+
+		name := labels[rawAttr(n, "id")]
+		for a := n.Parent; name == "" && a != nil && a != form; a = a.Parent {
+			if a.Type == html.ElementNode && a.Data == "label" {
+				name = labelText(a)
+			}
+		}
+		for _, key := range []string{"aria-label", "placeholder", "title"} {
+			if name == "" {
+				name = strings.Join(strings.Fields(rawAttr(n, key)), " ")
+			}
+		}
+		if name == "" {
+			name = strings.Join(strings.FieldsFunc(rawAttr(n, "name"), func(r rune) bool {
+				return r == '_' || r == '-' || r == '[' || r == ']' || r == ' '
+			}), " ")
+		}
+		name = strings.TrimRight(name, " *:")
+		if name == "" {
+			return
+		}
+		if typ == "file" {
+			name += " upload"
+		}
+
+		// Radio buttons and checkboxes sharing a name are one field
+		key := strings.ToLower(name)
+		if typ == "radio" || typ == "checkbox" {
+			if group := rawAttr(n, "name"); group != "" {
+				key = group
+			}
+		}
+		if !seen[key] {
+			seen[key] = true
+			fields = append(fields, name)
+		}
+	})
+
+	return fields
+}
+
+// labelText returns the text of a label, without that of the controls it
+// holds
+func labelText(label *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && formControls[c.Data] {
+				continue
+			}
+			walk(c)
+		}
+	}
+	walk(label)
+
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// formSummary describes a form in a sentence, such as "Application form
+// with fields: name, email, CV upload"
+func formSummary(kind string, fields []string) string {
+	if len(fields) == 0 {
+		return kind
+	}
+
+	return kind + " with fields: " + strings.Join(fields, ", ")
+}
+
+// walkElements calls fn for each element below n
+func walkElements(n *html.Node, fn func(n *html.Node)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			fn(c)
+		}
+		walkElements(c, fn)
+	}
+}
@@ -0,0 +1,288 @@
+package cleaner
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"golang.org/x/net/html"
+)
+
+// Images selects how images are handled.
+type Images int
+
+const (
+	// ImagesWithAlt keeps images that have alt text and drops the rest
+	ImagesWithAlt Images = iota
+
+	// DropImages removes all images
+	DropImages
+
+	// AltTextImages replaces images with their alt text
+	AltTextImages
+
+	// KeepImages keeps all images, using the highest resolution srcset
+	// candidate as the source
+	KeepImages
+
+	// FigureImages keeps only images in figures with a caption, using the
+	// highest resolution srcset candidate as the source
+	FigureImages
+)
+
+// ParseImages parses an image handling name, as used on the command line.
+func ParseImages(name string) (Images, error) {
+	switch name {
+	case "with-alt", "":
+		return ImagesWithAlt, nil
+	case "drop":
+		return DropImages, nil
+	case "alt":
+		return AltTextImages, nil
+	case "keep":
+		return KeepImages, nil
+	case "figure":
+		return FigureImages, nil
+	default:
+		return ImagesWithAlt, fmt.Errorf("unknown image handling %q (want with-alt, drop, alt, keep or figure)", name)
+	}
+}
+
+// imageAction is what cleaning does with an image
+type imageAction int
+
+const (
+	keepImage imageAction = iota
+	altTextImage
+	dropImage
+)
+
+// action decides what happens to an image with the given attributes, and
+// whether it is in a captioned figure, and the rule responsible if it is not
+// kept
+func (m Images) action(attrs []html.Attribute, captioned bool) (imageAction, string) {
+	alt := hasAltText(attrs)
+
+	switch m {
+	case DropImages:
+		return dropImage, ruleImages
+	case AltTextImages:
+		if alt {
+			return altTextImage, ruleImages
+		}
+		return dropImage, ruleImageAlt
+	case KeepImages:
+		return keepImage, ""
+	case FigureImages:
+		if captioned {
+			return keepImage, ""
+		}
+		return dropImage, ruleImages
+	default:
+		if alt {
+			return keepImage, ""
+		}
+		return dropImage, ruleImageAlt
+	}
+}
+
+// bestSource reports whether images kept in this mode use their highest
+// resolution source
+func (m Images) bestSource() bool {
+	return m == KeepImages || m == FigureImages
+}
+
+// processImageNode keeps, replaces or removes an image according to the
+// image mode, reporting whether it was kept
+func processImageNode(n *html.Node, mode Images, report *Report) bool {
+	action, rule := mode.action(n.Attr, inCaptionedFigure(n))
+	switch action {
+	case altTextImage:
+		report.removedElement(rule, n.Data)
+		if n.Parent != nil {
+			alt := &html.Node{Type: html.TextNode, Data: normaliseText(rawAttr(n, "alt"))}
+			n.Parent.InsertBefore(alt, n)
+		}
+		removeNode(n)
+		return false
+	case dropImage:
+		report.removed(rule, n)
+		removeNode(n)
+		return false
+	}
+
+	if mode.bestSource() {
+		n.Attr = useBestSource(n.Attr)
+	}
+
+	return true
+}
+
+// hasAltText reports whether an image has non-empty alt text
+func hasAltText(attrs []html.Attribute) bool {
+	for _, attr := range attrs {
+		if attr.Key == "alt" && attr.Val != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inCaptionedFigure reports whether an image is within a figure that has a
+// figcaption
+func inCaptionedFigure(n *html.Node) bool {
+	for a := n.Parent; a != nil; a = a.Parent {
+		if a.Type != html.ElementNode || a.Data != "figure" {
+			continue
+		}
+		for c := a.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.Data == "figcaption" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// useBestSource replaces the src of an image with its highest resolution
+// srcset candidate, dropping the srcset
+func useBestSource(attrs []html.Attribute) []html.Attribute {
+	var srcset string
+	newAttrs := attrs[:0]
+	for _, attr := range attrs {
+		if attr.Key == "srcset" {
+			srcset = attr.Val
+			continue
+		}
+		newAttrs = append(newAttrs, attr)
+	}
+
+	best := bestSrcsetURL(srcset)
+	if best == "" {
+		return newAttrs
+	}
+	for i, attr := range newAttrs {
+		if attr.Key == "src" {
+			newAttrs[i].Val = best
+			return newAttrs
+		}
+	}
+
+	return append(newAttrs, html.Attribute{Key: "src", Val: best})
+}
+
+// bestSrcsetURL returns the URL of the widest srcset candidate, or the one
+// with the highest pixel density if none give a width
+func bestSrcsetURL(srcset string) string {
+	var (
+		best      string
+		bestWidth float64
+		bestX     float64
+	)
+	for _, c := range parseSrcset(srcset) {
+		width, density := 0.0, 1.0
+		for _, d := range strings.Fields(c.descriptor) {
+			v, err := strconv.ParseFloat(d[:len(d)-1], 64)
+			if err != nil {
+				continue
+			}
+			switch d[len(d)-1] {
+			case 'w':
+				width = v
+			case 'x':
+				density = v
+			}
+		}
+
+		if width > bestWidth || (bestWidth == 0 && width == 0 && density > bestX) {
+			best, bestWidth, bestX = c.url, width, density
+		}
+	}
+
+	return best
+}
+
+// detectLogo returns the source of the image most likely to be the site
+// logo, judged by its names, alt text and position, or nothing if no image
+// is convincing
+func detectLogo(doc *html.Node) string {
+	var (
+		best      string
+		bestScore = config.MinLogoScore - 1
+	)
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "svg", "head", "script", "noscript":
+				return
+			case "img":
+				src := rawAttr(n, "src")
+				if src == "" || strings.HasPrefix(strings.ToLower(src), "data:") {
+					src = bestSrcsetURL(rawAttr(n, "srcset"))
+				}
+				if score := logoScore(n, src); src != "" && score > bestScore {
+					best, bestScore = src, score
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return best
+}
+
+// logoScore scores how likely an image is to be the site logo
+func logoScore(img *html.Node, src string) int {
+	var score int
+
+	if strings.Contains(getAttr(img, "class")+" "+getAttr(img, "id"), "logo") {
+		score += 3
+	}
+	if strings.Contains(getAttr(img, "alt"), "logo") {
+		score += 2
+	}
+	if u, err := url.Parse(src); err == nil && strings.Contains(strings.ToLower(path.Base(u.Path)), "logo") {
+		score += 2
+	}
+
+	// Logos sit in the page header, usually linking home; logos in the
+	// footer tend to belong to partners and awards
+	for a, depth := img.Parent, 0; a != nil && a.Type == html.ElementNode; a, depth = a.Parent, depth+1 {
+		names := getAttr(a, "class") + " " + getAttr(a, "id")
+		if depth < 3 && (strings.Contains(names, "logo") || strings.Contains(names, "brand")) {
+			score += 2
+		}
+
+		switch {
+		case a.Data == "a" && isHomeLink(getAttr(a, "href")):
+			score++
+		case a.Data == "header" || getAttr(a, "role") == "banner":
+			score += 2
+		case a.Data == "footer" || getAttr(a, "role") == "contentinfo":
+			score -= 3
+		}
+	}
+
+	return score
+}
+
+// isHomeLink reports whether an href points at the root of a site
+func isHomeLink(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil || href == "" {
+		return false
+	}
+
+	return (u.Path == "/" || (u.Path == "" && u.Host != "")) && u.RawQuery == ""
+}
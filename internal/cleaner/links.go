@@ -0,0 +1,240 @@
+package cleaner
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SpecialLinks selects how javascript:, mailto: and tel: links are handled.
+type SpecialLinks int
+
+const (
+	// KeepSpecialLinks keeps special links as they are
+	KeepSpecialLinks SpecialLinks = iota
+
+	// UnwrapSpecialLinks replaces special links with their text, adding the
+	// email address or phone number if the text does not show it
+	UnwrapSpecialLinks
+
+	// DropSpecialLinks removes special links and their text
+	DropSpecialLinks
+)
+
+// ParseSpecialLinks parses a special link handling name, as used on the command line.
+func ParseSpecialLinks(name string) (SpecialLinks, error) {
+	switch name {
+	case "keep", "":
+		return KeepSpecialLinks, nil
+	case "unwrap":
+		return UnwrapSpecialLinks, nil
+	case "drop":
+		return DropSpecialLinks, nil
+	default:
+		return KeepSpecialLinks, fmt.Errorf("unknown special link handling %q (want keep, unwrap or drop)", name)
+	}
+}
+
+// linkResolver makes link and image URLs absolute and handles special links
+type linkResolver struct {
+	base    *url.URL
+	special SpecialLinks
+	report  *Report
+}
+
+// newLinkResolver determines the base URL of the document from the page URL
+// and any base element. URLs are left as they are if neither is absolute.
+func newLinkResolver(doc *html.Node, opts Options, report *Report) (*linkResolver, error) {
+	r := &linkResolver{special: opts.SpecialLinks, report: report}
+
+	if opts.BaseURL != "" {
+		base, err := url.Parse(opts.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base URL: %v", err)
+		}
+		r.base = base
+	}
+
+	if doc != nil {
+		if b := findElement(doc, "base"); b != nil {
+			r.setBase(rawAttr(b, "href"))
+		}
+	}
+
+	return r, nil
+}
+
+// setBase applies the href of a base element to the base URL
+func (r *linkResolver) setBase(href string) {
+	ref, err := url.Parse(href)
+	if err != nil || href == "" {
+		return
+	}
+
+	if r.base != nil {
+		r.base = r.base.ResolveReference(ref)
+	} else if ref.IsAbs() {
+		r.base = ref
+	}
+}
+
+// resolve rewrites the href, src and srcset attributes in the subtree to
+// absolute URLs and handles special links
+func (r *linkResolver) resolve(n *html.Node) {
+	var next *html.Node
+	for c := n.FirstChild; c != nil; c = next {
+		next = c.NextSibling
+		r.resolve(c)
+	}
+
+	if n.Type != html.ElementNode {
+		return
+	}
+
+	if n.Data == "a" && r.special != KeepSpecialLinks && isSpecialLink(getAttr(n, "href")) {
+		r.handleSpecialLink(n)
+		return
+	}
+
+	r.resolveAttrs(n.Attr)
+}
+
+// resolveAttrs rewrites href, src and srcset attributes to absolute URLs
+func (r *linkResolver) resolveAttrs(attrs []html.Attribute) {
+	if r.base == nil {
+		return
+	}
+	for i, attr := range attrs {
+		switch attr.Key {
+		case "href", "src":
+			attrs[i].Val = r.resolveURL(attr.Val)
+		case "srcset":
+			attrs[i].Val = r.resolveSrcset(attr.Val)
+		}
+	}
+}
+
+// resolveURL resolves a reference against the base URL. Special and invalid
+// references are returned unchanged.
+func (r *linkResolver) resolveURL(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if r.base == nil || ref == "" || isSpecialLink(strings.ToLower(ref)) {
+		return ref
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+
+	return r.base.ResolveReference(u).String()
+}
+
+// resolveSrcset resolves each image candidate URL in a srcset attribute
+func (r *linkResolver) resolveSrcset(srcset string) string {
+	candidates := parseSrcset(srcset)
+	parts := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		part := r.resolveURL(c.url)
+		if c.descriptor != "" {
+			part += " " + c.descriptor
+		}
+		parts = append(parts, part)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// handleSpecialLink unwraps or drops a javascript:, mailto: or tel: link
+func (r *linkResolver) handleSpecialLink(n *html.Node) {
+	parent := n.Parent
+	if parent == nil {
+		return
+	}
+
+	if r.special == UnwrapSpecialLinks {
+		r.report.removedElement(ruleSpecialLink, n.Data)
+
+		href := rawAttr(n, "href")
+		for c := n.FirstChild; c != nil; c = n.FirstChild {
+			n.RemoveChild(c)
+			parent.InsertBefore(c, n)
+		}
+
+		// Keep the address if the link text hides it
+		if target := specialLinkTarget(href); target != "" && !strings.Contains(textContent(parent), target) {
+			parent.InsertBefore(&html.Node{Type: html.TextNode, Data: " (" + target + ")"}, n)
+		}
+	} else {
+		r.report.removed(ruleSpecialLink, n)
+	}
+
+	parent.RemoveChild(n)
+}
+
+// isSpecialLink reports whether a lowercased href is a javascript:, mailto:
+// or tel: link
+func isSpecialLink(href string) bool {
+	return strings.HasPrefix(href, "javascript:") || strings.HasPrefix(href, "mailto:") || strings.HasPrefix(href, "tel:")
+}
+
+// specialLinkTarget returns the email address or phone number of a mailto:
+// or tel: link
+func specialLinkTarget(href string) string {
+	lower := strings.ToLower(href)
+	for _, scheme := range []string{"mailto:", "tel:"} {
+		if strings.HasPrefix(lower, scheme) {
+			target := href[len(scheme):]
+			if i := strings.IndexByte(target, '?'); i >= 0 {
+				target = target[:i]
+			}
+			target, _ = url.PathUnescape(target)
+			return strings.TrimSpace(target)
+		}
+	}
+
+	return ""
+}
+
+// srcsetCandidate is an image candidate in a srcset attribute
+type srcsetCandidate struct {
+	url        string
+	descriptor string
+}
+
+// parseSrcset splits a srcset attribute into its image candidates, following
+// the HTML parsing rules: URLs may contain commas, but not trailing ones
+func parseSrcset(srcset string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+
+	rest := srcset
+	for {
+		rest = strings.TrimLeft(rest, " \t\n\r\f,")
+		if rest == "" {
+			return candidates
+		}
+
+		end := strings.IndexAny(rest, " \t\n\r\f")
+		if end == -1 {
+			end = len(rest)
+		}
+		c := srcsetCandidate{url: rest[:end]}
+		rest = rest[end:]
+
+		// A trailing comma ends the candidate without descriptors
+		if strings.HasSuffix(c.url, ",") {
+			c.url = strings.TrimRight(c.url, ",")
+		} else {
+			end = strings.IndexByte(rest, ',')
+			if end == -1 {
+				end = len(rest)
+			}
+			c.descriptor = strings.Join(strings.Fields(rest[:end]), " ")
+			rest = rest[end:]
+		}
+
+		candidates = append(candidates, c)
+	}
+}
@@ -0,0 +1,164 @@
+package cleaner
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Metadata is the page-level information held in the document head, which
+// cleaning removes, along with the logo and application link found in the
+// body.
+type Metadata struct {
+	Title          string            `json:"title,omitempty" yaml:"title,omitempty"`
+	Description    string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Canonical      string            `json:"canonical,omitempty" yaml:"canonical,omitempty"`
+	Lang           string            `json:"lang,omitempty" yaml:"lang,omitempty"`
+	SiteName       string            `json:"site_name,omitempty" yaml:"site_name,omitempty"`
+	Author         string            `json:"author,omitempty" yaml:"author,omitempty"`
+	Image          string            `json:"image,omitempty" yaml:"image,omitempty"`
+	Logo           string            `json:"logo,omitempty" yaml:"logo,omitempty"`
+	Icon           string            `json:"icon,omitempty" yaml:"icon,omitempty"`
+	Published      string            `json:"published,omitempty" yaml:"published,omitempty"`
+	Modified       string            `json:"modified,omitempty" yaml:"modified,omitempty"`
+	ApplicationURL string            `json:"application_url,omitempty" yaml:"application_url,omitempty"`
+	OpenGraph      map[string]string `json:"open_graph,omitempty" yaml:"open_graph,omitempty"`
+	Twitter        map[string]string `json:"twitter,omitempty" yaml:"twitter,omitempty"`
+}
+
+// Meta tag names and properties for each metadata field, in order of preference
+var (
+	descriptionKeys = []string{"description", "og:description", "twitter:description"}
+	siteNameKeys    = []string{"og:site_name", "application-name"}
+	authorKeys      = []string{"author", "article:author"}
+	imageKeys       = []string{"og:image", "og:image:url", "og:image:secure_url", "twitter:image", "twitter:image:src"}
+	logoKeys        = []string{"og:logo"}
+	publishedKeys   = []string{"article:published_time", "og:published_time", "datepublished", "date", "publish_date", "publish-date", "pubdate", "dc.date", "dc.date.issued", "dcterms.created", "dcterms.issued"}
+	modifiedKeys    = []string{"article:modified_time", "og:updated_time", "datemodified", "last-modified", "dcterms.modified"}
+)
+
+// extractMetadata collects the title, meta tags, canonical link, icon and
+// language of the document
+func extractMetadata(doc *html.Node) *Metadata {
+	m := &Metadata{
+		OpenGraph: make(map[string]string),
+		Twitter:   make(map[string]string),
+	}
+	meta := make(map[string]string)
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "html":
+				m.Lang = rawAttr(n, "lang")
+				if m.Lang == "" {
+					m.Lang = rawAttr(n, "xml:lang")
+				}
+			case "title":
+				// Titles in inline SVG are not the page title
+				if m.Title == "" && !inSVG(n) {
+					m.Title = strings.Join(strings.Fields(textContent(n)), " ")
+				}
+			case "meta":
+				key := getAttr(n, "property")
+				if key == "" {
+					key = getAttr(n, "name")
+				}
+				if key == "" {
+					key = getAttr(n, "itemprop")
+				}
+				if key == "" {
+					key = getAttr(n, "http-equiv")
+				}
+				content := rawAttr(n, "content")
+				if key != "" && content != "" {
+					if _, ok := meta[key]; !ok {
+						meta[key] = content
+					}
+					switch {
+					case strings.HasPrefix(key, "og:"):
+						m.OpenGraph[strings.TrimPrefix(key, "og:")] = content
+					case strings.HasPrefix(key, "twitter:"):
+						m.Twitter[strings.TrimPrefix(key, "twitter:")] = content
+					}
+				}
+			case "link":
+				rels := strings.Fields(getAttr(n, "rel"))
+				href := rawAttr(n, "href")
+				for _, rel := range rels {
+					switch rel {
+					case "canonical":
+						if m.Canonical == "" {
+							m.Canonical = href
+						}
+					case "apple-touch-icon", "icon":
+						// Touch icons are larger, so are preferred
+						if m.Icon == "" || rel == "apple-touch-icon" {
+							m.Icon = href
+						}
+					}
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if m.Title == "" {
+		m.Title = firstOf(meta, "og:title", "twitter:title")
+	}
+	m.Description = firstOf(meta, descriptionKeys...)
+	m.SiteName = firstOf(meta, siteNameKeys...)
+	m.Author = firstOf(meta, authorKeys...)
+	m.Image = firstOf(meta, imageKeys...)
+	m.Logo = firstOf(meta, logoKeys...)
+	m.Published = firstOf(meta, publishedKeys...)
+	m.Modified = firstOf(meta, modifiedKeys...)
+	if m.Canonical == "" {
+		m.Canonical = firstOf(meta, "og:url")
+	}
+
+	if len(m.OpenGraph) == 0 {
+		m.OpenGraph = nil
+	}
+	if len(m.Twitter) == 0 {
+		m.Twitter = nil
+	}
+
+	return m
+}
+
+// resolve makes the URLs in the metadata absolute
+func (m *Metadata) resolve(r *linkResolver) {
+	m.Canonical = r.resolveURL(m.Canonical)
+	m.Image = r.resolveURL(m.Image)
+	m.Logo = r.resolveURL(m.Logo)
+	m.Icon = r.resolveURL(m.Icon)
+	m.ApplicationURL = r.resolveURL(m.ApplicationURL)
+}
+
+// firstOf returns the first non-empty value for the given keys
+func firstOf(meta map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if val := meta[key]; val != "" {
+			return val
+		}
+	}
+
+	return ""
+}
+
+// inSVG reports whether a node is within an SVG element
+func inSVG(n *html.Node) bool {
+	for a := n.Parent; a != nil; a = a.Parent {
+		if a.Type == html.ElementNode && a.Data == "svg" {
+			return true
+		}
+	}
+
+	return false
+}
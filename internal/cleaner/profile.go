@@ -0,0 +1,212 @@
+package cleaner
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is a user-supplied set of cleaning rules, loaded from YAML or JSON.
+//
+// Domain profiles override the top-level rules for pages on that host or its
+// subdomains: Include and KeepAttributes replace the top-level values when
+// set, and Exclude selectors are added to the top-level ones.
+type Profile struct {
+	// Include lists CSS selectors for the only content to keep
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+
+	// Exclude lists CSS selectors for content to remove
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+
+	// KeepAttributes lists the HTML attributes to keep, replacing
+	// config.KeepAttributes
+	KeepAttributes []string `json:"keep_attributes,omitempty" yaml:"keep_attributes,omitempty"`
+
+	// Domains maps host names to the profile used for their pages
+	Domains map[string]*Profile `json:"domains,omitempty" yaml:"domains,omitempty"`
+}
+
+// LoadProfile reads a cleaning profile from a YAML or JSON file and checks
+// that its selectors are valid.
+func LoadProfile(path string) (*Profile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %w", err)
+	}
+
+	// JSON is valid YAML, so one decoder handles both
+	var p Profile
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse profile: %w", err)
+	}
+
+	if _, err := compileProfile(&p); err != nil {
+		return nil, err
+	}
+	for host, dp := range p.Domains {
+		if dp == nil {
+			return nil, fmt.Errorf("empty profile for domain %s", host)
+		}
+		if _, err := compileProfile(dp); err != nil {
+			return nil, fmt.Errorf("domain %s: %w", host, err)
+		}
+	}
+
+	return &p, nil
+}
+
+// ForURL returns the rules that apply to a page, merging the most specific
+// matching domain profile over the top-level rules.
+func (p *Profile) ForURL(pageURL string) *Profile {
+	if p == nil {
+		return nil
+	}
+
+	rules := &Profile{
+		Include:        p.Include,
+		Exclude:        p.Exclude,
+		KeepAttributes: p.KeepAttributes,
+	}
+
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return rules
+	}
+	host := strings.ToLower(u.Hostname())
+
+	var (
+		match    *Profile
+		matchLen int
+	)
+	for domain, dp := range p.Domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if (host == domain || strings.HasSuffix(host, "."+domain)) && len(domain) > matchLen {
+			match, matchLen = dp, len(domain)
+		}
+	}
+	if match == nil {
+		return rules
+	}
+
+	if len(match.Include) > 0 {
+		rules.Include = match.Include
+	}
+	rules.Exclude = append(append([]string(nil), rules.Exclude...), match.Exclude...)
+	if len(match.KeepAttributes) > 0 {
+		rules.KeepAttributes = match.KeepAttributes
+	}
+
+	return rules
+}
+
+// compiledProfile holds the parsed selectors and attribute allow-list of a profile
+type compiledProfile struct {
+	include        cascadia.SelectorGroup
+	exclude        cascadia.SelectorGroup
+	keepAttributes map[string]bool
+}
+
+// compileProfile parses the selectors of a profile. A nil profile compiles to
+// the default rules.
+func compileProfile(p *Profile) (*compiledProfile, error) {
+	c := &compiledProfile{keepAttributes: config.KeepAttributes}
+	if p == nil {
+		return c, nil
+	}
+
+	var err error
+	if c.include, err = parseSelectors(p.Include); err != nil {
+		return nil, err
+	}
+	if c.exclude, err = parseSelectors(p.Exclude); err != nil {
+		return nil, err
+	}
+
+	if len(p.KeepAttributes) > 0 {
+		c.keepAttributes = make(map[string]bool, len(p.KeepAttributes))
+		for _, attr := range p.KeepAttributes {
+			c.keepAttributes[strings.ToLower(attr)] = true
+		}
+	}
+
+	return c, nil
+}
+
+// apply removes excluded elements and, if any include selectors match,
+// replaces the body with the included elements
+func (c *compiledProfile) apply(doc *html.Node, report *Report) {
+	if len(c.exclude) > 0 {
+		excluded := cascadia.QueryAll(doc, c.exclude)
+		for _, n := range excluded {
+			// The root has no parent and is never removed, and matches
+			// nested in other matches go with their ancestor
+			if n.Parent != nil && !hasAncestor(n, excluded) {
+				report.removed(ruleProfileExclude, n)
+				n.Parent.RemoveChild(n)
+			}
+		}
+	}
+
+	if len(c.include) == 0 {
+		return
+	}
+	body := findElement(doc, "body")
+	if body == nil {
+		return
+	}
+
+	// Matches nested in other matches are kept with their ancestor
+	var included []*html.Node
+	for _, n := range cascadia.QueryAll(body, c.include) {
+		if !hasAncestor(n, included) {
+			included = append(included, n)
+		}
+	}
+	if len(included) == 0 {
+		return
+	}
+
+	for _, n := range included {
+		n.Parent.RemoveChild(n)
+	}
+	for child := body.FirstChild; child != nil; child = body.FirstChild {
+		report.removed(ruleProfileInclude, child)
+		body.RemoveChild(child)
+	}
+	for _, n := range included {
+		body.AppendChild(n)
+	}
+}
+
+// parseSelectors parses a list of CSS selectors into a single group
+func parseSelectors(selectors []string) (cascadia.SelectorGroup, error) {
+	var group cascadia.SelectorGroup
+	for _, sel := range selectors {
+		g, err := cascadia.ParseGroup(sel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %v", sel, err)
+		}
+		group = append(group, g...)
+	}
+
+	return group, nil
+}
+
+// hasAncestor reports whether any of the candidates is an ancestor of n
+func hasAncestor(n *html.Node, candidates []*html.Node) bool {
+	for a := n.Parent; a != nil; a = a.Parent {
+		for _, c := range candidates {
+			if a == c {
+				return true
+			}
+		}
+	}
+
+	return false
+}
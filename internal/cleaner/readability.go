@@ -0,0 +1,303 @@
+package cleaner
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"golang.org/x/net/html"
+)
+
+var (
+	// negativeClass matches class and id values of blocks unlikely to be main content
+	negativeClass = regexp.MustCompile(`(?i)comment|meta|footer|footnote|sidebar|nav|menu|banner|breadcrumb|share|social|related|promo|cookie|newsletter|popup|modal|widget`)
+
+	// positiveClass matches class and id values of blocks likely to be main content
+	positiveClass = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|text|job|description|posting|vacanc`)
+)
+
+// blockElements are elements that break a div or section out of being
+// treated as a paragraph when scoring
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"div": true, "dl": true, "fieldset": true, "figure": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "hr": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"ul": true,
+}
+
+// nodeStats holds the text measurements of a node's subtree
+type nodeStats struct {
+	text   int
+	link   int
+	commas int
+}
+
+// extractMainContent replaces the body of the document with the block that
+// most likely holds the primary content, along with any related siblings. The
+// document is left untouched if no suitable block is found.
+func extractMainContent(doc *html.Node, report *Report) {
+	body := findElement(doc, "body")
+	if body == nil {
+		return
+	}
+
+	stats := make(map[*html.Node]*nodeStats)
+	collectStats(body, stats, false)
+
+	scores := scoreCandidates(body, stats)
+	top := topCandidate(scores, stats)
+	if top == nil || top == body {
+		return
+	}
+
+	// Semantic landmarks mark the content boundary more reliably than scores,
+	// and usually include the job title heading
+	for a := top.Parent; a != nil && a != body; a = a.Parent {
+		if isMainLandmark(a) {
+			top = a
+			break
+		}
+	}
+
+	selected := selectSiblings(top, scores, stats)
+	for _, n := range selected {
+		n.Parent.RemoveChild(n)
+	}
+
+	for c := body.FirstChild; c != nil; c = body.FirstChild {
+		report.removed(ruleMainContent, c)
+		body.RemoveChild(c)
+	}
+	for _, n := range selected {
+		body.AppendChild(n)
+	}
+}
+
+// collectStats measures the text, link text and commas of every element in
+// the subtree, returning the measurements of n
+func collectStats(n *html.Node, stats map[*html.Node]*nodeStats, inLink bool) *nodeStats {
+	s := &nodeStats{}
+
+	switch n.Type {
+	case html.TextNode:
+		text := strings.Join(strings.Fields(n.Data), " ")
+		s.text = utf8.RuneCountInString(text)
+		s.commas = strings.Count(text, ",") + strings.Count(text, "，")
+		if inLink {
+			s.link = s.text
+		}
+		return s
+	case html.ElementNode:
+		if config.UnwantedElements[n.Data] {
+			return s
+		}
+		inLink = inLink || n.Data == "a"
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		cs := collectStats(c, stats, inLink)
+		s.text += cs.text
+		s.link += cs.link
+		s.commas += cs.commas
+	}
+
+	if n.Type == html.ElementNode {
+		stats[n] = s
+	}
+
+	return s
+}
+
+// scoreCandidates scores paragraph-like elements and propagates their scores
+// to their ancestors, returning the score of every candidate block
+func scoreCandidates(body *html.Node, stats map[*html.Node]*nodeStats) map[*html.Node]float64 {
+	scores := make(map[*html.Node]float64)
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type != html.ElementNode || config.UnwantedElements[n.Data] {
+			return
+		}
+
+		if isParagraph(n) && stats[n].text >= config.MinParagraphLength {
+			s := stats[n]
+			score := 1 + float64(s.commas) + min(float64(s.text)/100, 3)
+
+			level := 1
+			for a := n.Parent; a != nil && a.Type == html.ElementNode && level <= 3; a = a.Parent {
+				if _, ok := scores[a]; !ok {
+					scores[a] = initialScore(a)
+				}
+				scores[a] += score / float64(level)
+				level++
+				if a == body {
+					break
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(body)
+
+	// Content buried in links is navigation rather than prose
+	for n, score := range scores {
+		scores[n] = score * (1 - linkDensity(stats[n]))
+	}
+
+	return scores
+}
+
+// topCandidate returns the highest scoring candidate, or nil if none
+func topCandidate(scores map[*html.Node]float64, stats map[*html.Node]*nodeStats) *html.Node {
+	var (
+		top      *html.Node
+		topScore float64
+	)
+	for n, score := range scores {
+		// Break ties on text length so the result is deterministic
+		if top == nil || score > topScore || (score == topScore && stats[n].text > stats[top].text) {
+			top, topScore = n, score
+		}
+	}
+
+	return top
+}
+
+// selectSiblings returns the top candidate together with any siblings that
+// look like a continuation of the same content, in document order
+func selectSiblings(top *html.Node, scores map[*html.Node]float64, stats map[*html.Node]*nodeStats) []*html.Node {
+	if top.Parent == nil {
+		return []*html.Node{top}
+	}
+
+	threshold := max(10, scores[top]*0.2)
+
+	var selected []*html.Node
+	for c := top.Parent.FirstChild; c != nil; c = c.NextSibling {
+		if c == top {
+			selected = append(selected, c)
+			continue
+		}
+		if c.Type != html.ElementNode || config.UnwantedElements[c.Data] {
+			continue
+		}
+
+		if score, ok := scores[c]; ok && score >= threshold {
+			selected = append(selected, c)
+			continue
+		}
+
+		// Standalone paragraphs of prose next to the content belong with it
+		if s := stats[c]; c.Data == "p" && s != nil && s.text > 80 && linkDensity(s) < 0.25 {
+			selected = append(selected, c)
+		}
+	}
+
+	return selected
+}
+
+// initialScore returns the base score of a candidate block from its tag,
+// role and class names
+func initialScore(n *html.Node) float64 {
+	var score float64
+
+	switch n.Data {
+	case "main", "article":
+		score += 25
+	case "div", "section":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	case "nav", "aside", "footer", "header":
+		score -= 25
+	}
+
+	switch getAttr(n, "role") {
+	case "main", "article":
+		score += 25
+	case "navigation", "banner", "contentinfo", "complementary":
+		score -= 25
+	}
+
+	classAndID := getAttr(n, "class") + " " + getAttr(n, "id")
+	if negativeClass.MatchString(classAndID) {
+		score -= 25
+	}
+	if positiveClass.MatchString(classAndID) {
+		score += 25
+	}
+
+	return score
+}
+
+// isParagraph reports whether an element holds a run of prose: a paragraph
+// or a div or section with no block-level children
+func isParagraph(n *html.Node) bool {
+	switch n.Data {
+	case "p", "pre", "td", "blockquote", "dd", "li":
+		return true
+	case "div", "section":
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && blockElements[c.Data] {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// isMainLandmark reports whether an element is marked up as the main content
+func isMainLandmark(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+
+	return n.Data == "main" || n.Data == "article" || getAttr(n, "role") == "main"
+}
+
+// linkDensity returns the proportion of text within links
+func linkDensity(s *nodeStats) float64 {
+	if s == nil || s.text == 0 {
+		return 0
+	}
+
+	return float64(s.link) / float64(s.text)
+}
+
+// findElement returns the first element with the given tag in the subtree
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// getAttr returns the lowercased, trimmed value of an attribute, or an empty
+// string if the node does not have it
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return strings.ToLower(strings.TrimSpace(attr.Val))
+		}
+	}
+
+	return ""
+}
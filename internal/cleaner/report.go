@@ -0,0 +1,201 @@
+package cleaner
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"golang.org/x/net/html"
+)
+
+// Cleaning rules, as named in a report
+const (
+	ruleTemplate       = "template"
+	ruleHidden         = "hidden"
+	ruleProfileExclude = "profile-exclude"
+	ruleProfileInclude = "profile-include"
+	ruleBoilerplate    = "boilerplate"
+	ruleMainContent    = "main-content"
+	ruleSpecialLink    = "special-link"
+	ruleForm           = "form"
+	ruleUnwanted       = "unwanted-element"
+	ruleComment        = "comment"
+	ruleImageAlt       = "image-without-alt"
+	ruleImages         = "images"
+	ruleEmpty          = "empty"
+)
+
+// Report describes what cleaning removed from a page, to help tune the
+// cleaning rules.
+type Report struct {
+	BytesBefore  int `json:"bytes_before"`
+	BytesAfter   int `json:"bytes_after"`
+	TokensBefore int `json:"tokens_before"`
+	TokensAfter  int `json:"tokens_after"`
+
+	// Elements counts the removed elements by tag, including those within
+	// removed subtrees
+	Elements map[string]int `json:"elements,omitempty"`
+
+	// Rules counts the removals made by each cleaning rule
+	Rules map[string]int `json:"rules,omitempty"`
+
+	// Attributes counts the removed attributes by name
+	Attributes map[string]int `json:"attributes,omitempty"`
+
+	// Largest lists the largest removed subtrees, largest first
+	Largest []RemovedSubtree `json:"largest,omitempty"`
+
+	// Notes lists the options that could not be applied to the page
+	Notes []string `json:"notes,omitempty"`
+}
+
+// RemovedSubtree is an element, comment or text removed by a cleaning rule.
+type RemovedSubtree struct {
+	Rule    string `json:"rule"`
+	Tag     string `json:"tag"`
+	Bytes   int    `json:"bytes"`
+	Excerpt string `json:"excerpt,omitempty"`
+}
+
+// newReport starts an empty report
+func newReport() *Report {
+	return &Report{
+		Elements:   make(map[string]int),
+		Rules:      make(map[string]int),
+		Attributes: make(map[string]int),
+	}
+}
+
+// removed records a subtree removed by a rule. Nil reports record nothing,
+// so callers need not check whether reporting is enabled.
+func (r *Report) removed(rule string, n *html.Node) {
+	if r == nil {
+		return
+	}
+	r.Rules[rule]++
+
+	var count func(n *html.Node)
+	count = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			r.Elements[n.Data]++
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			count(c)
+		}
+	}
+	count(n)
+
+	text := textContent(n)
+	if n.Type == html.CommentNode {
+		text = n.Data
+	}
+
+	var size byteCounter
+	if err := html.Render(&size, n); err != nil {
+		return
+	}
+	r.addLargest(RemovedSubtree{
+		Rule:    rule,
+		Tag:     nodeName(n),
+		Bytes:   int(size),
+		Excerpt: excerpt(text),
+	})
+}
+
+// removedElement records an element removed by a rule without its content
+func (r *Report) removedElement(rule, tag string) {
+	if r == nil {
+		return
+	}
+	r.Rules[rule]++
+	r.Elements[tag]++
+}
+
+// note records an option that could not be applied
+func (r *Report) note(msg string) {
+	if r == nil {
+		return
+	}
+	r.Notes = append(r.Notes, msg)
+}
+
+// removedAttribute records a removed attribute
+func (r *Report) removedAttribute(key string) {
+	if r == nil {
+		return
+	}
+	r.Attributes[key]++
+}
+
+// addLargest adds a removed subtree to the largest list if it is big enough
+func (r *Report) addLargest(s RemovedSubtree) {
+	i := sort.Search(len(r.Largest), func(i int) bool {
+		return r.Largest[i].Bytes < s.Bytes
+	})
+	if i >= config.ReportLargestSubtrees {
+		return
+	}
+
+	r.Largest = append(r.Largest, RemovedSubtree{})
+	copy(r.Largest[i+1:], r.Largest[i:])
+	r.Largest[i] = s
+	if len(r.Largest) > config.ReportLargestSubtrees {
+		r.Largest = r.Largest[:config.ReportLargestSubtrees]
+	}
+}
+
+// finish records the sizes in bytes of the HTML before and after cleaning
+func (r *Report) finish(before, after int) {
+	if r == nil {
+		return
+	}
+	r.BytesBefore, r.TokensBefore = before, estimateTokens(before)
+	r.BytesAfter, r.TokensAfter = after, estimateTokens(after)
+}
+
+// estimateTokens estimates the number of model tokens in n bytes of text
+func estimateTokens(n int) int {
+	return (n + config.BytesPerToken - 1) / config.BytesPerToken
+}
+
+// nodeName returns the tag of an element, or a name for other node types
+func nodeName(n *html.Node) string {
+	switch n.Type {
+	case html.ElementNode:
+		return n.Data
+	case html.TextNode:
+		return "#text"
+	case html.CommentNode:
+		return "#comment"
+	default:
+		return "#node"
+	}
+}
+
+// excerpt shortens text to the report excerpt length, collapsing whitespace
+func excerpt(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= config.ReportExcerptLength {
+		return text
+	}
+
+	runes := []rune(text)
+	return string(runes[:config.ReportExcerptLength]) + "…"
+}
+
+// byteCounter is a writer that counts the bytes written to it
+type byteCounter int
+
+// Write implements io.Writer
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// WriteString implements io.StringWriter
+func (c *byteCounter) WriteString(s string) (int, error) {
+	*c += byteCounter(len(s))
+	return len(s), nil
+}
@@ -0,0 +1,661 @@
+package cleaner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"golang.org/x/net/html"
+)
+
+// voidElements have no end tag, so are never skipped past or nested
+var voidElements = map[string]bool{
+	"area":   true,
+	"base":   true,
+	"br":     true,
+	"col":    true,
+	"embed":  true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"keygen": true,
+	"link":   true,
+	"meta":   true,
+	"param":  true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+// Stream cleans UTF-8 HTML read from r and writes it to w without building a
+// tree, so memory use is bounded by the largest single token rather than the
+// size of the document.
+//
+// The output matches Clean for well-formed pages, except that tables,
+// definition lists and empty elements are left as they are and line breaks
+// may differ; Clean finishes streamed pages as a tree so they match. Options
+// that need the whole tree are not applied: the full page is kept rather than the main content,
+// boilerplate, special links and forms are kept, profile selectors are
+// ignored and images with alt text are kept rather than only figure images.
+// Each option not applied is noted in the report, which is nil unless
+// enabled in the options. No structured data or metadata is captured.
+func Stream(w io.Writer, r io.Reader, opts Options) (*Report, error) {
+	return stream(w, r, opts, false)
+}
+
+// stream cleans HTML as Stream does, keeping the attributes table
+// normalisation needs if tableAttrs is set
+func stream(w io.Writer, r io.Reader, opts Options, tableAttrs bool) (*Report, error) {
+	rules, err := compileProfile(opts.Profile.ForURL(opts.BaseURL))
+	if err != nil {
+		return nil, err
+	}
+
+	var report *Report
+	if opts.Report {
+		report = newReport()
+	}
+	if opts.Mode != FullPage {
+		opts.Mode = FullPage
+		report.note("main content mode is not supported when streaming; the full page was kept")
+	}
+	if opts.Boilerplate != BoilerplateOff {
+		opts.Boilerplate = BoilerplateOff
+		report.note("boilerplate removal is not supported when streaming; boilerplate was kept")
+	}
+	if opts.SpecialLinks != KeepSpecialLinks {
+		opts.SpecialLinks = KeepSpecialLinks
+		report.note("special link handling is not supported when streaming; special links were kept")
+	}
+	if len(rules.include) > 0 || len(rules.exclude) > 0 {
+		report.note("profile selectors are not supported when streaming; they were ignored")
+	}
+	if opts.Forms == SummariseForms {
+		opts.Forms = KeepForms
+		report.note("form summaries are not supported when streaming; forms were kept")
+	}
+	if opts.Images == FigureImages {
+		opts.Images = ImagesWithAlt
+		report.note("keeping only figure images is not supported when streaming; images with alt text were kept")
+	}
+
+	resolver, err := newLinkResolver(nil, opts, report)
+	if err != nil {
+		return nil, err
+	}
+
+	keepAttrs := rules.keepAttributes
+	if tableAttrs {
+		keepAttrs = make(map[string]bool)
+		for key := range rules.keepAttributes {
+			keepAttrs[key] = true
+		}
+		for _, key := range tableAttributes {
+			keepAttrs[key] = true
+		}
+	}
+
+	in := &countingReader{r: r}
+	var out byteCounter
+	bw := bufio.NewWriter(io.MultiWriter(w, &out))
+	s := &streamCleaner{
+		z:          html.NewTokenizer(in),
+		out:        &emptyLineWriter{w: bw},
+		resolver:   resolver,
+		keepAttrs:  keepAttrs,
+		keepHidden: opts.KeepHidden,
+		images:     opts.Images,
+		dropForms:  opts.Forms == DropForms,
+		report:     report,
+	}
+	if err := s.run(); err != nil {
+		return nil, err
+	}
+	if err := s.out.close(); err != nil {
+		return nil, fmt.Errorf("failed to write HTML: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write HTML: %v", err)
+	}
+	report.finish(in.n, int(out))
+
+	return report, nil
+}
+
+// streamCleaner applies the tree cleaning steps token by token
+type streamCleaner struct {
+	z          *html.Tokenizer
+	out        *emptyLineWriter
+	resolver   *linkResolver
+	keepAttrs  map[string]bool
+	keepHidden bool
+	images     Images
+	dropForms  bool
+	report     *Report
+
+	// skipTag and skipDepth track the element being removed with its subtree
+	skipTag   string
+	skipDepth int
+
+	// skipped records the element being removed for the report, and
+	// skipText its text outside any nested scripts and styles
+	skipped  RemovedSubtree
+	skipText strings.Builder
+	inScript bool
+
+	// inHTML and inBody record the html and body elements written so far,
+	// whose end tags are held until the end of the document as the parser
+	// moves trailing content into the body
+	inHTML bool
+	inBody bool
+
+	// seenHead is set once the head has been passed; whitespace before it is
+	// dropped by the parser
+	seenHead bool
+
+	// afterPre is set after a start tag whose first newline the parser drops
+	afterPre bool
+
+	// tables records, for each open table, whether a row group is open and
+	// whether it was implied by a row outside one
+	tables []tableState
+}
+
+// tableState tracks the row groups of an open table
+type tableState struct {
+	inGroup bool
+	implied bool
+}
+
+// run copies the cleaned tokens to the output until the input ends
+func (s *streamCleaner) run() error {
+	for {
+		tt := s.z.Next()
+		if tt == html.ErrorToken {
+			if err := s.z.Err(); err != io.EOF {
+				return fmt.Errorf("failed to parse HTML: %v", err)
+			}
+			break
+		}
+		tok := s.z.Token()
+
+		if s.skipTag != "" {
+			if err := s.skip(tok); err != nil {
+				return err
+			}
+			continue
+		}
+		if tok.Type == html.CommentToken {
+			s.removed(ruleComment, "#comment", tok.Data)
+			continue
+		}
+
+		var err error
+		switch tok.Type {
+		case html.TextToken:
+			err = s.text(tok.Data)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			err = s.startTag(tok)
+		case html.EndTagToken:
+			err = s.endTag(tok)
+		case html.DoctypeToken:
+			if !s.inHTML {
+				err = s.write(tok.String())
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if tok.Type != html.TextToken && !(tok.Type == html.StartTagToken && isPreTag(tok.Data)) {
+			s.afterPre = false
+		}
+	}
+
+	if s.inBody {
+		if err := s.write("</body>"); err != nil {
+			return err
+		}
+	}
+	if s.inHTML {
+		return s.write("</html>")
+	}
+
+	return nil
+}
+
+// skip consumes a token inside a removed element, ending the skip at its
+// end tag
+func (s *streamCleaner) skip(tok html.Token) error {
+	// The head end tag is optional
+	if s.skipTag == "head" && tok.Type == html.StartTagToken && tok.Data == "body" {
+		s.endSkip()
+		return s.startTag(tok)
+	}
+
+	if s.report != nil {
+		s.skipped.Bytes += len(s.z.Raw())
+	}
+
+	switch tok.Type {
+	case html.TextToken:
+		// Collapsing whitespace shortens the excerpt, so keep some spare
+		if s.report != nil && !s.inScript && s.skipText.Len() < 4*config.ReportExcerptLength {
+			s.skipText.WriteString(tok.Data)
+		}
+	case html.StartTagToken, html.SelfClosingTagToken:
+		if s.report != nil {
+			s.report.Elements[tok.Data]++
+		}
+		s.inScript = tok.Type == html.StartTagToken && (tok.Data == "script" || tok.Data == "style")
+		if s.skipTag == "head" && tok.Data == "base" {
+			s.resolver.setBase(tokenAttr(tok, "href"))
+		}
+		if tok.Type == html.StartTagToken && tok.Data == s.skipTag && !voidElements[tok.Data] {
+			s.skipDepth++
+		}
+	case html.EndTagToken:
+		s.inScript = false
+		if tok.Data == s.skipTag {
+			s.skipDepth--
+			if s.skipDepth == 0 {
+				s.endSkip()
+			}
+		}
+	}
+
+	return nil
+}
+
+// startSkip begins removing an element with its subtree
+func (s *streamCleaner) startSkip(rule, tag string) {
+	s.skipTag, s.skipDepth = tag, 1
+
+	if s.report != nil {
+		s.report.Rules[rule]++
+		s.report.Elements[tag]++
+		s.skipped = RemovedSubtree{Rule: rule, Tag: tag, Bytes: len(s.z.Raw())}
+	}
+}
+
+// endSkip resumes output after a removed element
+func (s *streamCleaner) endSkip() {
+	if s.skipTag == "head" {
+		s.seenHead = true
+	}
+	s.skipTag = ""
+	s.skipDepth = 0
+
+	if s.report != nil {
+		s.skipped.Excerpt = excerpt(s.skipText.String())
+		s.report.addLargest(s.skipped)
+		s.skipText.Reset()
+	}
+}
+
+// removed records a token removed by a rule with nothing inside it
+func (s *streamCleaner) removed(rule, tag, text string) {
+	if s.report == nil {
+		return
+	}
+	s.report.Rules[rule]++
+	if !strings.HasPrefix(tag, "#") {
+		s.report.Elements[tag]++
+	}
+	s.report.addLargest(RemovedSubtree{
+		Rule:    rule,
+		Tag:     tag,
+		Bytes:   len(s.z.Raw()),
+		Excerpt: excerpt(text),
+	})
+}
+
+// text writes normalised text, dropping the whitespace the parser ignores
+func (s *streamCleaner) text(data string) error {
+	if s.afterPre {
+		s.afterPre = false
+		data = strings.TrimPrefix(data, "\n")
+		// Rendering restores a leading newline that would otherwise be lost
+		if strings.HasPrefix(data, "\n") {
+			data = "\n" + data
+		}
+	}
+
+	blank := strings.TrimSpace(data) == ""
+	if !s.inBody {
+		if blank && !s.seenHead {
+			return nil
+		}
+		if !blank {
+			if err := s.openBody(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.write(html.EscapeString(normaliseText(data)))
+}
+
+// startTag writes a start tag with its attributes cleaned, or begins skipping
+// a removed element
+func (s *streamCleaner) startTag(tok html.Token) error {
+	void := voidElements[tok.Data]
+
+	var rule string
+	switch {
+	case !s.keepHidden && tokenHasAttr(tok, config.HiddenMarkerAttribute):
+		rule = ruleHidden
+	case config.UnwantedElements[tok.Data]:
+		rule = ruleUnwanted
+	case s.dropForms && (tok.Data == "form" || formControls[tok.Data]):
+		rule = ruleForm
+	case tok.Data == "img":
+		var action imageAction
+		switch action, rule = s.images.action(tok.Attr, false); action {
+		case altTextImage:
+			s.report.removedElement(rule, tok.Data)
+			return s.text(tokenAttr(tok, "alt"))
+		case keepImage:
+			rule = ""
+		}
+	}
+	if rule != "" {
+		if !void && tok.Type == html.StartTagToken {
+			s.startSkip(rule, tok.Data)
+		} else {
+			s.removed(rule, tok.Data, "")
+		}
+		return nil
+	}
+
+	switch tok.Data {
+	case "html":
+		if s.inHTML {
+			return nil
+		}
+		s.inHTML = true
+	case "body":
+		if s.inBody {
+			return nil
+		}
+		if err := s.openHTML(); err != nil {
+			return err
+		}
+		s.inBody = true
+		s.seenHead = true
+	default:
+		if err := s.openBody(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.tableStart(tok.Data); err != nil {
+		return err
+	}
+
+	s.resolver.resolveAttrs(tok.Attr)
+	if tok.Data == "img" && s.images.bestSource() {
+		tok.Attr = useBestSource(tok.Attr)
+	}
+	tok.Attr = filterAttributes(tok.Attr, s.keepAttrs, s.report)
+
+	// The parser ignores self-closing syntax on non-void elements, and
+	// rendering writes void elements as self-closing
+	tok.Type = html.StartTagToken
+	if void {
+		tok.Type = html.SelfClosingTagToken
+	}
+	if isPreTag(tok.Data) {
+		s.afterPre = true
+	}
+
+	return s.write(tok.String())
+}
+
+// endTag writes an end tag, holding back those of the html and body elements
+func (s *streamCleaner) endTag(tok html.Token) error {
+	switch tok.Data {
+	case "html", "body":
+		return nil
+	case "head":
+		s.seenHead = true
+		return nil
+	}
+	if voidElements[tok.Data] {
+		return nil
+	}
+
+	if err := s.tableEnd(tok.Data); err != nil {
+		return err
+	}
+
+	return s.write("</" + tok.Data + ">")
+}
+
+// tableStart inserts the row group the parser adds around rows written
+// directly in a table
+func (s *streamCleaner) tableStart(tag string) error {
+	switch tag {
+	case "table":
+		s.tables = append(s.tables, tableState{})
+	case "tbody", "thead", "tfoot":
+		if t := s.table(); t != nil {
+			if t.implied {
+				t.implied = false
+				if err := s.write("</tbody>"); err != nil {
+					return err
+				}
+			}
+			t.inGroup = true
+		}
+	case "tr":
+		if t := s.table(); t != nil && !t.inGroup {
+			t.inGroup, t.implied = true, true
+			return s.write("<tbody>")
+		}
+	}
+
+	return nil
+}
+
+// tableEnd closes any implied row group when its table ends
+func (s *streamCleaner) tableEnd(tag string) error {
+	t := s.table()
+	if t == nil {
+		return nil
+	}
+
+	switch tag {
+	case "table":
+		s.tables = s.tables[:len(s.tables)-1]
+		if t.implied {
+			return s.write("</tbody>")
+		}
+	case "tbody", "thead", "tfoot":
+		t.inGroup = false
+	}
+
+	return nil
+}
+
+// table returns the state of the innermost open table
+func (s *streamCleaner) table() *tableState {
+	if len(s.tables) == 0 {
+		return nil
+	}
+
+	return &s.tables[len(s.tables)-1]
+}
+
+// openHTML writes the html start tag if the document has not
+func (s *streamCleaner) openHTML() error {
+	if s.inHTML {
+		return nil
+	}
+	s.inHTML = true
+
+	return s.write("<html>")
+}
+
+// openBody writes the body start tag if the document has not, as the
+// parser implies one before the first content
+func (s *streamCleaner) openBody() error {
+	if s.inBody {
+		return nil
+	}
+	if err := s.openHTML(); err != nil {
+		return err
+	}
+	s.inBody = true
+	s.seenHead = true
+
+	return s.write("<body>")
+}
+
+// write writes a string to the output
+func (s *streamCleaner) write(str string) error {
+	if _, err := io.WriteString(s.out, str); err != nil {
+		return fmt.Errorf("failed to write HTML: %v", err)
+	}
+
+	return nil
+}
+
+// isPreTag reports whether the parser drops a newline directly after the
+// start tag of an element
+func isPreTag(tag string) bool {
+	return tag == "pre" || tag == "listing" || tag == "textarea"
+}
+
+// tokenAttr returns the value of a token attribute
+func tokenAttr(tok html.Token, key string) string {
+	for _, attr := range tok.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+
+	return ""
+}
+
+// tokenHasAttr reports whether a token has an attribute, whatever its value
+func tokenHasAttr(tok html.Token, key string) bool {
+	for _, attr := range tok.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// countingReader is a reader that counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+// Read implements io.Reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// emptyLineWriter removes consecutive empty lines as removeEmptyLines does,
+// holding back only the whitespace of the current line
+type emptyLineWriter struct {
+	w io.Writer
+
+	// pending holds the whitespace of a line not yet known to be kept
+	pending []byte
+
+	// lineOpen is set once the current line has non-whitespace content
+	lineOpen bool
+
+	// prevEmpty is set if the last kept line was empty
+	prevEmpty bool
+
+	// started is set once the first line has ended
+	started bool
+}
+
+// Write implements io.Writer
+func (e *emptyLineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if e.lineOpen {
+			i := bytes.IndexByte(p, '\n')
+			if i == -1 {
+				_, err := e.w.Write(p)
+				return n, err
+			}
+			if _, err := e.w.Write(p[:i]); err != nil {
+				return n, err
+			}
+			if err := e.endLine(); err != nil {
+				return n, err
+			}
+			p = p[i+1:]
+			continue
+		}
+
+		r, size := utf8.DecodeRune(p)
+		switch {
+		case r == '\n':
+			if err := e.endLine(); err != nil {
+				return n, err
+			}
+		case unicode.IsSpace(r):
+			e.pending = append(e.pending, p[:size]...)
+		default:
+			if err := e.keepLine(); err != nil {
+				return n, err
+			}
+			e.lineOpen = true
+			e.prevEmpty = false
+			continue
+		}
+		p = p[size:]
+	}
+
+	return n, nil
+}
+
+// keepLine writes the separator and held whitespace of the current line
+func (e *emptyLineWriter) keepLine() error {
+	if e.started {
+		if _, err := e.w.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	_, err := e.w.Write(e.pending)
+	e.pending = e.pending[:0]
+
+	return err
+}
+
+// endLine finishes the current line, dropping it if it is empty and follows
+// another empty line
+func (e *emptyLineWriter) endLine() error {
+	if !e.lineOpen && !e.prevEmpty {
+		if err := e.keepLine(); err != nil {
+			return err
+		}
+		e.prevEmpty = true
+	}
+	e.pending = e.pending[:0]
+	e.lineOpen = false
+	e.started = true
+
+	return nil
+}
+
+// close finishes the last line
+func (e *emptyLineWriter) close() error {
+	return e.endLine()
+}
@@ -0,0 +1,250 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// StructuredData holds the machine-readable data embedded in a page, such as
+// schema.org JobPosting markup.
+type StructuredData struct {
+	// JSONLD holds each valid application/ld+json block
+	JSONLD []json.RawMessage `json:"json_ld,omitempty"`
+
+	// Microdata holds the top-level itemscope items
+	Microdata []*Item `json:"microdata,omitempty"`
+
+	// RDFa holds the top-level typeof items
+	RDFa []*Item `json:"rdfa,omitempty"`
+}
+
+// Item is a microdata or RDFa item. Property values are either strings or
+// nested items.
+type Item struct {
+	Type       []string         `json:"type,omitempty"`
+	ID         string           `json:"id,omitempty"`
+	Properties map[string][]any `json:"properties"`
+}
+
+// Empty reports whether no structured data was found.
+func (s *StructuredData) Empty() bool {
+	return s == nil || len(s.JSONLD) == 0 && len(s.Microdata) == 0 && len(s.RDFa) == 0
+}
+
+// itemVocab names the attributes used by an item markup syntax
+type itemVocab struct {
+	scope string
+	typ   string
+	prop  string
+	id    []string
+
+	// content is true if a content attribute overrides any property value
+	content bool
+}
+
+var (
+	microdataVocab = itemVocab{scope: "itemscope", typ: "itemtype", prop: "itemprop", id: []string{"itemid"}}
+	rdfaVocab      = itemVocab{scope: "typeof", typ: "typeof", prop: "property", id: []string{"resource", "about"}, content: true}
+)
+
+// extractStructuredData collects JSON-LD, microdata and RDFa from the document
+func extractStructuredData(doc *html.Node) *StructuredData {
+	return &StructuredData{
+		JSONLD:    extractJSONLD(doc, nil),
+		Microdata: extractItems(doc, microdataVocab, nil),
+		RDFa:      extractItems(doc, rdfaVocab, nil),
+	}
+}
+
+// extractJSONLD appends the content of every valid JSON-LD script in the subtree
+func extractJSONLD(n *html.Node, blocks []json.RawMessage) []json.RawMessage {
+	if n.Type == html.ElementNode && n.Data == "script" && isJSONLDType(getAttr(n, "type")) {
+		var sb strings.Builder
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.TextNode {
+				sb.WriteString(c.Data)
+			}
+		}
+
+		content := unwrapJSONLD(sb.String())
+		if json.Valid([]byte(content)) {
+			blocks = append(blocks, json.RawMessage(content))
+		}
+		return blocks
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		blocks = extractJSONLD(c, blocks)
+	}
+
+	return blocks
+}
+
+// isJSONLDType reports whether a script type attribute is the JSON-LD media
+// type, ignoring case and parameters such as charset
+func isJSONLDType(typ string) bool {
+	mediaType, _, err := mime.ParseMediaType(typ)
+	return err == nil && mediaType == "application/ld+json"
+}
+
+// jsonLDWrappers are the comment and CDATA markers some sites wrap JSON-LD
+// in, as opening and closing pairs, longest first
+var jsonLDWrappers = [][2]string{
+	{"//<![CDATA[", "//]]>"},
+	{"<![CDATA[", "]]>"},
+	{"<!--", "-->"},
+}
+
+// unwrapJSONLD strips the comment and CDATA markers wrapping a JSON-LD block,
+// leaving any within the JSON itself
+func unwrapJSONLD(content string) string {
+	content = strings.TrimSpace(content)
+	for {
+		unwrapped := content
+		for _, w := range jsonLDWrappers {
+			if strings.HasPrefix(unwrapped, w[0]) {
+				unwrapped = strings.TrimSpace(strings.TrimPrefix(unwrapped, w[0]))
+			}
+			if strings.HasSuffix(unwrapped, w[1]) {
+				unwrapped = strings.TrimSpace(strings.TrimSuffix(unwrapped, w[1]))
+			}
+		}
+		if unwrapped == content {
+			return content
+		}
+		content = unwrapped
+	}
+}
+
+// extractItems appends every top-level item in the subtree; items that are
+// themselves properties are nested in their parent item instead
+func extractItems(n *html.Node, v itemVocab, items []*Item) []*Item {
+	if n.Type == html.ElementNode && hasAttr(n, v.scope) && !hasAttr(n, v.prop) {
+		items = append(items, buildItem(n, v))
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		items = extractItems(c, v, items)
+	}
+
+	return items
+}
+
+// buildItem builds an item from a scope element and the properties within it
+func buildItem(n *html.Node, v itemVocab) *Item {
+	item := &Item{
+		Type:       strings.Fields(rawAttr(n, v.typ)),
+		Properties: make(map[string][]any),
+	}
+	for _, key := range v.id {
+		if id := rawAttr(n, key); id != "" {
+			item.ID = id
+			break
+		}
+	}
+
+	var walk func(p *html.Node)
+	walk = func(p *html.Node) {
+		for c := p.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+
+			if names := strings.Fields(rawAttr(c, v.prop)); len(names) > 0 {
+				var value any
+				if hasAttr(c, v.scope) {
+					value = buildItem(c, v)
+				} else {
+					value = propertyValue(c, v)
+				}
+				for _, name := range names {
+					item.Properties[name] = append(item.Properties[name], value)
+				}
+			}
+
+			// Nested items own the properties within them
+			if !hasAttr(c, v.scope) {
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+
+	return item
+}
+
+// propertyValue returns the value of a property element, following the
+// microdata rules for which attribute holds the value
+func propertyValue(n *html.Node, v itemVocab) string {
+	if v.content {
+		if content, ok := attrOK(n, "content"); ok {
+			return content
+		}
+	}
+
+	var key string
+	switch n.Data {
+	case "meta":
+		key = "content"
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		key = "src"
+	case "a", "area", "link":
+		key = "href"
+	case "object":
+		key = "data"
+	case "data", "meter":
+		key = "value"
+	case "time":
+		key = "datetime"
+	}
+	if key != "" {
+		if val, ok := attrOK(n, key); ok {
+			return val
+		}
+	}
+
+	return strings.Join(strings.Fields(textContent(n)), " ")
+}
+
+// textContent returns the concatenated text of the subtree
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (c.Data == "script" || c.Data == "style") {
+			continue
+		}
+		sb.WriteString(textContent(c))
+	}
+
+	return sb.String()
+}
+
+// hasAttr reports whether a node has an attribute
+func hasAttr(n *html.Node, key string) bool {
+	_, ok := attrOK(n, key)
+	return ok
+}
+
+// rawAttr returns the trimmed value of an attribute without changing its case
+func rawAttr(n *html.Node, key string) string {
+	val, _ := attrOK(n, key)
+	return val
+}
+
+// attrOK returns the trimmed value of an attribute and whether it is present
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return strings.TrimSpace(attr.Val), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,400 @@
+package cleaner
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// tableAttributes are the attributes table normalisation relies on, which
+// cleaning strips
+var tableAttributes = []string{"role", "summary", "colspan", "rowspan"}
+
+// layoutBlocks hold page sections rather than values, so a table with any
+// of them in its cells is used for layout
+var layoutBlocks = map[string]bool{
+	"article":    true,
+	"aside":      true,
+	"blockquote": true,
+	"div":        true,
+	"footer":     true,
+	"form":       true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"header":     true,
+	"main":       true,
+	"nav":        true,
+	"ol":         true,
+	"section":    true,
+	"ul":         true,
+}
+
+// dataTableMarkers only appear in tables of data
+var dataTableMarkers = map[string]bool{
+	"caption":  true,
+	"col":      true,
+	"colgroup": true,
+	"tfoot":    true,
+	"th":       true,
+	"thead":    true,
+}
+
+// normaliseTables unwraps layout tables, rebuilds data tables as a simple
+// grid and tidies definition lists, so they convert cleanly to Markdown.
+// Inner tables are handled before the tables holding them.
+func normaliseTables(n *html.Node) {
+	var next *html.Node
+	for c := n.FirstChild; c != nil; c = next {
+		next = c.NextSibling
+		normaliseTables(c)
+	}
+
+	if n.Type != html.ElementNode || n.Parent == nil {
+		return
+	}
+
+	switch n.Data {
+	case "table":
+		if isLayoutTable(n) {
+			unwrapTable(n)
+		} else {
+			normaliseDataTable(n)
+		}
+	case "dl":
+		normaliseDefinitionList(n)
+	}
+}
+
+// isLayoutTable reports whether a table arranges page content rather than
+// holding data, using its role, markup and shape
+func isLayoutTable(t *html.Node) bool {
+	switch getAttr(t, "role") {
+	case "presentation", "none":
+		return true
+	}
+	if hasAttr(t, "summary") {
+		return false
+	}
+
+	var nested, marked, blocks bool
+	walkTable(t, func(n *html.Node) {
+		switch {
+		case n.Data == "table":
+			nested = true
+		case dataTableMarkers[n.Data]:
+			marked = true
+		case layoutBlocks[n.Data]:
+			blocks = true
+		}
+	})
+	if nested {
+		return true
+	}
+	if marked {
+		return false
+	}
+
+	rows := tableRows(t)
+	var cols int
+	for _, tr := range rows {
+		cols = max(cols, len(rowCells(tr)))
+	}
+	if len(rows) < 2 || cols < 2 {
+		return true
+	}
+
+	return blocks
+}
+
+// unwrapTable replaces a layout table with the contents of its cells
+func unwrapTable(t *html.Node) {
+	for _, tr := range tableRows(t) {
+		for _, cell := range rowCells(tr) {
+			if cell.FirstChild == nil {
+				continue
+			}
+
+			div := element("div")
+			for c := cell.FirstChild; c != nil; c = cell.FirstChild {
+				cell.RemoveChild(c)
+				div.AppendChild(c)
+			}
+			t.Parent.InsertBefore(div, t)
+		}
+	}
+
+	t.Parent.RemoveChild(t)
+}
+
+// normaliseDataTable rebuilds a data table as a single header row, empty if
+// none is found, and body rows of equal length. Cells spanning several rows
+// or columns are repeated in each position they cover, so no values are lost.
+func normaliseDataTable(t *html.Node) {
+	rows := tableRows(t)
+
+	// grid holds the cell covering each position of the table
+	grid := make([][]*html.Node, len(rows))
+	var width int
+	for r, tr := range rows {
+		col := 0
+		for _, cell := range rowCells(tr) {
+			for col < len(grid[r]) && grid[r][col] != nil {
+				col++
+			}
+
+			colspan := spanAttr(cell, "colspan", config.MaxTableSpan)
+			rowspan := spanAttr(cell, "rowspan", len(rows)-r)
+			for dr := 0; dr < rowspan; dr++ {
+				row := grid[r+dr]
+				for len(row) < col+colspan {
+					row = append(row, nil)
+				}
+				for dc := 0; dc < colspan; dc++ {
+					row[col+dc] = cell
+				}
+				grid[r+dr] = row
+			}
+			col += colspan
+		}
+		width = max(width, len(grid[r]))
+	}
+	if width == 0 {
+		return
+	}
+
+	headers := headerRows(rows)
+
+	var caption *html.Node
+	for c := t.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "caption" {
+			caption = c
+			break
+		}
+	}
+
+	// Markdown tables need a header row, so one is always given
+	head := element("thead")
+	head.AppendChild(headerRow(grid[:headers], width))
+	body := element("tbody")
+	for _, row := range grid[headers:] {
+		if tr := gridRow(row, width); tr != nil {
+			body.AppendChild(tr)
+		}
+	}
+
+	for c := t.FirstChild; c != nil; c = t.FirstChild {
+		t.RemoveChild(c)
+	}
+	if caption != nil {
+		t.AppendChild(caption)
+	}
+	t.AppendChild(head)
+	t.AppendChild(body)
+}
+
+// headerRows returns the number of leading rows that hold column headings:
+// those in a thead, or otherwise a first row made only of th cells
+func headerRows(rows []*html.Node) int {
+	var n int
+	for _, tr := range rows {
+		if tr.Parent == nil || tr.Parent.Data != "thead" {
+			break
+		}
+		n++
+	}
+	if n > 0 || len(rows) < 2 {
+		return n
+	}
+
+	cells := rowCells(rows[0])
+	for _, cell := range cells {
+		if cell.Data != "th" {
+			return 0
+		}
+	}
+
+	return 1
+}
+
+// headerRow merges the header rows of a grid into a single row of th cells.
+// A lone header row keeps its markup; stacked rows are joined as text.
+func headerRow(rows [][]*html.Node, width int) *html.Node {
+	tr := element("tr")
+	for col := 0; col < width; col++ {
+		th := element("th")
+
+		switch len(rows) {
+		case 0:
+			// No header was found, so the row is left empty
+		case 1:
+			if col < len(rows[0]) && rows[0][col] != nil {
+				copyChildren(th, rows[0][col])
+			}
+		default:
+			var parts []string
+			for _, row := range rows {
+				if col >= len(row) || row[col] == nil {
+					continue
+				}
+				text := strings.Join(strings.Fields(textContent(row[col])), " ")
+				if text != "" && (len(parts) == 0 || parts[len(parts)-1] != text) {
+					parts = append(parts, text)
+				}
+			}
+			th.AppendChild(&html.Node{Type: html.TextNode, Data: strings.Join(parts, " ")})
+		}
+
+		tr.AppendChild(th)
+	}
+
+	return tr
+}
+
+// gridRow builds a row from a grid row, padded to the table width. Rows
+// without any text or images are dropped.
+func gridRow(row []*html.Node, width int) *html.Node {
+	tr := element("tr")
+	var content bool
+	for col := 0; col < width; col++ {
+		if col >= len(row) || row[col] == nil {
+			tr.AppendChild(element("td"))
+			continue
+		}
+
+		cell := element(row[col].Data)
+		if strings.TrimSpace(textContent(row[col])) != "" || findElement(row[col], "img") != nil {
+			content = true
+		}
+		copyChildren(cell, row[col])
+		tr.AppendChild(cell)
+	}
+
+	if !content {
+		return nil
+	}
+
+	return tr
+}
+
+// copyChildren appends copies of the children of src to dst; spanning
+// cells are copied into every position they cover
+func copyChildren(dst, src *html.Node) {
+	for c := src.FirstChild; c != nil; c = c.NextSibling {
+		dst.AppendChild(cloneNode(c))
+	}
+}
+
+// normaliseDefinitionList lifts terms and definitions out of the div
+// wrappers HTML allows around them, so they convert as a flat list
+func normaliseDefinitionList(dl *html.Node) {
+	var next *html.Node
+	for c := dl.FirstChild; c != nil; c = next {
+		next = c.NextSibling
+		if c.Type != html.ElementNode || c.Data != "div" {
+			continue
+		}
+
+		for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+			c.RemoveChild(gc)
+			dl.InsertBefore(gc, c)
+		}
+		dl.RemoveChild(c)
+	}
+}
+
+// tableRows returns the rows of a table, excluding those of nested tables
+func tableRows(t *html.Node) []*html.Node {
+	var rows []*html.Node
+	for c := t.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "tr":
+			rows = append(rows, c)
+		case "thead", "tbody", "tfoot":
+			for r := c.FirstChild; r != nil; r = r.NextSibling {
+				if r.Type == html.ElementNode && r.Data == "tr" {
+					rows = append(rows, r)
+				}
+			}
+		}
+	}
+
+	return rows
+}
+
+// rowCells returns the td and th cells of a row
+func rowCells(tr *html.Node) []*html.Node {
+	var cells []*html.Node
+	for c := tr.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (c.Data == "td" || c.Data == "th") {
+			cells = append(cells, c)
+		}
+	}
+
+	return cells
+}
+
+// walkTable calls fn for each element in a table, not descending into nested
+// tables
+func walkTable(t *html.Node, fn func(n *html.Node)) {
+	for c := t.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		fn(c)
+		if c.Data != "table" {
+			walkTable(c, fn)
+		}
+	}
+}
+
+// spanAttr returns a colspan or rowspan value, limited to the given maximum.
+// Missing and invalid values are 1, and a rowspan of 0 spans the remaining rows.
+func spanAttr(cell *html.Node, key string, limit int) int {
+	v := getAttr(cell, key)
+	if v == "" {
+		return 1
+	}
+
+	n, err := strconv.Atoi(v)
+	switch {
+	case err != nil || n < 0:
+		return 1
+	case n == 0 && key == "rowspan", n > limit:
+		return max(limit, 1)
+	case n == 0:
+		return 1
+	}
+
+	return n
+}
+
+// element creates an element node
+func element(tag string) *html.Node {
+	return &html.Node{Type: html.ElementNode, DataAtom: atom.Lookup([]byte(tag)), Data: tag}
+}
+
+// cloneNode returns a deep copy of a node and its children
+func cloneNode(n *html.Node) *html.Node {
+	clone := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      append([]html.Attribute(nil), n.Attr...),
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		clone.AppendChild(cloneNode(c))
+	}
+
+	return clone
+}
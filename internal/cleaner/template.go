@@ -0,0 +1,204 @@
+package cleaner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"golang.org/x/net/html"
+)
+
+// Template learns the blocks repeated across the pages of each site in a
+// batch, such as headers, footers and "Why work here" sections, so they can
+// be stripped from every page and kept once as site context. It is safe for
+// concurrent use.
+//
+// Blocks are matched by a fingerprint of their tag structure and text,
+// ignoring attributes, scripts and comments, which often vary per page.
+type Template struct {
+	mu    sync.Mutex
+	hosts map[string]*siteTemplate
+}
+
+// siteTemplate holds what has been learned about the pages of one host
+type siteTemplate struct {
+	pages  int
+	counts map[string]int
+
+	// context holds the HTML of each stripped block, once, in the order
+	// they were first stripped
+	context  []string
+	stripped map[string]bool
+}
+
+// NewTemplate creates a new, empty Template.
+func NewTemplate() *Template {
+	return &Template{hosts: make(map[string]*siteTemplate)}
+}
+
+// Learn records the blocks of a page. Every page of a batch should be
+// learned before any is cleaned, as blocks are only stripped once they are
+// known to repeat.
+func (t *Template) Learn(pageURL, rawHTML string) error {
+	if len(rawHTML) > config.MaxContentLength {
+		return fmt.Errorf("HTML content exceeds maximum allowed length (%d bytes)", config.MaxContentLength)
+	}
+
+	doc, err := html.Parse(strings.NewReader(rawHTML))
+	if err != nil {
+		return fmt.Errorf("failed to parse HTML: %v", err)
+	}
+	body := findElement(doc, "body")
+	if body == nil {
+		return nil
+	}
+
+	// Blocks repeated within a page count once
+	blocks := make(map[string]bool)
+	fingerprint(body, func(_ *html.Node, fp string) {
+		blocks[fp] = true
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	site := t.site(pageURL)
+	site.pages++
+	for fp := range blocks {
+		site.counts[fp]++
+	}
+
+	return nil
+}
+
+// SiteContext returns the HTML of the blocks stripped from pages on the same
+// host as the given page, each once. It is empty if nothing was stripped.
+func (t *Template) SiteContext(pageURL string) string {
+	if t == nil {
+		return ""
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	site, ok := t.hosts[templateHost(pageURL)]
+	if !ok {
+		return ""
+	}
+
+	return strings.Join(site.context, "\n")
+}
+
+// strip removes the blocks of a page that repeat across its site
+func (t *Template) strip(doc *html.Node, pageURL string, report *Report) {
+	if t == nil {
+		return
+	}
+	body := findElement(doc, "body")
+	if body == nil {
+		return
+	}
+
+	fingerprints := make(map[*html.Node]string)
+	fingerprint(body, func(n *html.Node, fp string) {
+		fingerprints[n] = fp
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	site, ok := t.hosts[templateHost(pageURL)]
+	if !ok {
+		return
+	}
+	minCount := max(config.TemplateMinPages, int(math.Ceil(config.TemplatePageRatio*float64(site.pages))))
+
+	// Strip the outermost repeated blocks, which take their contents with them
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		var next *html.Node
+		for c := n.FirstChild; c != nil; c = next {
+			next = c.NextSibling
+
+			fp, ok := fingerprints[c]
+			if !ok || site.counts[fp] < minCount {
+				walk(c)
+				continue
+			}
+
+			if !site.stripped[fp] {
+				site.stripped[fp] = true
+				var buf bytes.Buffer
+				if err := html.Render(&buf, c); err == nil {
+					site.context = append(site.context, buf.String())
+				}
+			}
+			report.removed(ruleTemplate, c)
+			n.RemoveChild(c)
+		}
+	}
+	walk(body)
+}
+
+// site returns the template of the host of a page, creating it if needed
+func (t *Template) site(pageURL string) *siteTemplate {
+	host := templateHost(pageURL)
+	site, ok := t.hosts[host]
+	if !ok {
+		site = &siteTemplate{
+			counts:   make(map[string]int),
+			stripped: make(map[string]bool),
+		}
+		t.hosts[host] = site
+	}
+
+	return site
+}
+
+// templateHost returns the host name pages are grouped by
+func templateHost(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// fingerprint hashes the tag structure and normalised text of the subtree,
+// calling visit with the fingerprint of each block with enough text to be
+// part of a site template. The hash of n is returned with its text length.
+func fingerprint(n *html.Node, visit func(n *html.Node, fp string)) (string, int) {
+	h := sha256.New()
+	h.Write([]byte("<" + n.Data + ">"))
+
+	var textLen int
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.TextNode:
+			text := strings.ToLower(strings.Join(strings.Fields(c.Data), " "))
+			h.Write([]byte(text))
+			textLen += len(text)
+		case html.ElementNode:
+			if config.UnwantedElements[c.Data] || hasAttr(c, config.HiddenMarkerAttribute) {
+				continue
+			}
+			fp, cl := fingerprint(c, visit)
+			h.Write([]byte(fp))
+			textLen += cl
+		}
+	}
+	h.Write([]byte("</" + n.Data + ">"))
+
+	fp := string(h.Sum(nil))
+	if n.Data != "body" && textLen >= config.TemplateMinTextLength {
+		visit(n, fp)
+	}
+
+	return fp, textLen
+}
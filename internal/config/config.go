@@ -22,10 +22,120 @@ const (
 	DefaultClassifierModelDir = "models"
 )
 
+// Pagination configurations
+const (
+	// DefaultMaxPages is the default maximum number of listing pages to follow
+	DefaultMaxPages = 10
+
+	// DefaultNextLinkSelector is the CSS selector used to find the next page link
+	DefaultNextLinkSelector = `link[rel~="next"], a[rel~="next"]`
+
+	// PageNumberPlaceholder is replaced with the page number in pagination URL templates
+	PageNumberPlaceholder = "{page}"
+
+	// PaginationSettleSeconds is how long the DOM must be stable after clicking a next button
+	PaginationSettleSeconds = 1
+)
+
+// Listing configurations
+const (
+	// DefaultDetailLinkSelector is the CSS selector for candidate detail links on a listing page
+	DefaultDetailLinkSelector = "a[href]"
+
+	// DetailLinkThreshold is the minimum job posting score for a link to be treated as a detail link
+	DetailLinkThreshold = 0.8
+)
+
+// Site template configurations
+const (
+	// TemplateMinPages is the minimum number of pages of a site a block must
+	// appear on to be treated as part of the site template
+	TemplateMinPages = 3
+
+	// TemplatePageRatio is the minimum fraction of the pages of a site a
+	// block must appear on to be treated as part of the site template
+	TemplatePageRatio = 0.5
+
+	// TemplateMinTextLength is the minimum text length of a block considered
+	// for the site template
+	TemplateMinTextLength = 20
+)
+
+// Token budget configurations
+const (
+	// ClassifierTokenBudget is the number of tokens of content given to the classifier, counted with its
+	// tokenizer, leaving room within its 1024 token input limit for the hypothesis and special tokens and
+	// for tokens merged differently when blocks counted separately are joined
+	ClassifierTokenBudget = 900
+
+	// ChunkMaxTokens is the default maximum number of tokens in a Markdown chunk
+	ChunkMaxTokens = 2000
+
+	// ChunkOverlapTokens is the default number of tokens repeated from the previous chunk when a section is split
+	ChunkOverlapTokens = 100
+
+	// ChunkMinFill is the fraction of the maximum chunk size a chunk must reach before a heading starts a new chunk
+	ChunkMinFill = 0.5
+
+	// BudgetBoilerplateMaxWords is the maximum number of words in a block trimmed first as boilerplate
+	BudgetBoilerplateMaxWords = 40
+
+	// BudgetMaxLinkDensity is the fraction of the text of a block in links above which it is trimmed as a link list
+	BudgetMaxLinkDensity = 0.5
+)
+
+// Language detection configurations
+const (
+	// LanguageSampleLength is the maximum number of bytes of text used to detect its language
+	LanguageSampleLength = 10000
+
+	// LanguageMinWords is the minimum number of words needed to detect the language of text
+	LanguageMinWords = 20
+
+	// LanguageMinRatio is the minimum fraction of words that must be common words of the detected language
+	LanguageMinRatio = 0.1
+
+	// LanguageMargin is how many times more common words the detected language must have than the next
+	LanguageMargin = 1.5
+)
+
 // HTML and Markdown configurations
 const (
 	// MaxContentLength is the maximum allowed length of HTML content to process
 	MaxContentLength = 10 * 1024 * 1024 // 10MB
+
+	// HiddenMarkerAttribute is set by the scraper on elements that are not visible in the rendered page
+	HiddenMarkerAttribute = "data-toyscraper-hidden"
+
+	// MinParagraphLength is the minimum text length of a paragraph scored when finding main content
+	MinParagraphLength = 25
+
+	// BytesPerToken is the approximate number of bytes per model token, used to estimate token counts
+	BytesPerToken = 4
+
+	// MaxTableSpan is the largest colspan expanded when normalising data tables
+	MaxTableSpan = 50
+
+	// MinLogoScore is the score an image needs to be detected as the company logo
+	MinLogoScore = 3
+
+	// ReportLargestSubtrees is the number of largest removed subtrees listed in a cleaning report
+	ReportLargestSubtrees = 10
+
+	// ReportExcerptLength is the maximum length of the text excerpt of a removed subtree or block in a report
+	ReportExcerptLength = 80
+)
+
+// Markdown normalisation configurations
+const (
+	// LinkFarmMinLinks is the minimum number of link-only items in a list for it to be collapsed
+	LinkFarmMinLinks = 15
+
+	// LinkFarmKeepLinks is the number of items kept when a link-only list is collapsed
+	LinkFarmKeepLinks = 5
+
+	// DuplicateBlockMinLength is the minimum text length of a boilerplate block removed when repeated
+	DuplicateBlockMinLength = 20
 )
 
 // Content extraction configurations.
@@ -50,7 +160,7 @@ Extract job posting details, using markdown structure to:
 3. Parse salary information from specially formatted elements if available
 4. Determine application deadline from timestamp or date elements
 
-Use markdown format and structure to enhance extraction accuracy.
+Use markdown format and structure to enhance extraction accuracy.%s
 </user_request>
 
 <schema_block>
@@ -85,6 +195,20 @@ var ClassificationLabels = []string{
 	"careers",
 }
 
+// LanguageClassificationLabels are the classification labels used for content in languages other than English
+var LanguageClassificationLabels = map[string][]string{
+	"de": {"Stellenanzeige", "Stellenangebote", "Karriere"},
+	"fr": {"offre d'emploi", "liste d'offres d'emploi", "carrières"},
+	"nl": {"vacature", "vacatureoverzicht", "werken bij"},
+}
+
+// ExtractionLanguageNotes are added to the extraction prompt for content in languages other than English
+var ExtractionLanguageNotes = map[string]string{
+	"de": `The content is in German. Keep extracted text in German, but use the schema field names as given. Gender markers such as "(m/w/d)" are not part of the job title. Salaries are often given as "brutto" per month or year, and "Bewerbungsfrist" is the application deadline.`,
+	"fr": `The content is in French. Keep extracted text in French, but use the schema field names as given. Gender markers such as "(H/F)" are not part of the job title. Salaries are often given as "brut annuel", and "date limite de candidature" is the application deadline.`,
+	"nl": `The content is in Dutch. Keep extracted text in Dutch, but use the schema field names as given. Gender markers such as "(m/v/x)" are not part of the job title. Salaries are often given as "bruto per maand", and "sluitingsdatum" is the application deadline.`,
+}
+
 // List of unwanted element tags to remove during cleaning
 var UnwantedElements = map[string]bool{
 	"script":   true,
@@ -102,8 +226,89 @@ var UnwantedElements = map[string]bool{
 
 // List of HTML attributes to keep during cleaning
 var KeepAttributes = map[string]bool{
-	"alt":   true,
-	"title": true,
-	"href":  true,
-	"src":   true,
+	"alt":    true,
+	"title":  true,
+	"href":   true,
+	"src":    true,
+	"srcset": true,
+}
+
+// TrackingParamPrefixes are query parameter prefixes stripped during URL canonicalisation
+var TrackingParamPrefixes = []string{
+	"utm_",
+}
+
+// TrackingParams are query parameters stripped during URL canonicalisation
+var TrackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+	"_gl":     true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+}
+
+// BoilerplateTags are landmark element tags removed as boilerplate during cleaning
+var BoilerplateTags = map[string]bool{
+	"nav":    true,
+	"header": true,
+	"footer": true,
+	"aside":  true,
+}
+
+// BudgetBoilerplatePhrases mark short Markdown blocks trimmed first as boilerplate when content exceeds a token budget
+var BudgetBoilerplatePhrases = []string{
+	"cookie",
+	"all rights reserved",
+	"©",
+	"copyright",
+	"privacy policy",
+	"terms of use",
+	"terms and conditions",
+	"subscribe",
+	"follow us",
+	"sign in",
+	"log in",
+	"share this",
+}
+
+// BoilerplateRoles are ARIA roles removed as boilerplate during cleaning
+var BoilerplateRoles = map[string]bool{
+	"navigation":    true,
+	"banner":        true,
+	"contentinfo":   true,
+	"complementary": true,
+	"search":        true,
+}
+
+// BoilerplatePatterns are class and id name prefixes removed as boilerplate during aggressive cleaning
+var BoilerplatePatterns = []string{
+	"menu",
+	"breadcrumb",
+	"cookie",
+	"consent",
+	"newsletter",
+	"subscribe",
+	"share",
+	"social",
+	"sidebar",
+	"related",
+	"promo",
+	"advert",
+	"popup",
+	"modal",
+	"skip",
+}
+
+// LanguageBoilerplatePatterns are class and id name prefixes removed as boilerplate during aggressive cleaning of content in other languages
+var LanguageBoilerplatePatterns = map[string][]string{
+	"de": {"brotkrumen", "datenschutz", "impressum", "teilen", "werbung"},
+	"fr": {"ariane", "partage", "publicite", "infolettre", "mentions"},
+	"nl": {"kruimelpad", "delen", "nieuwsbrief", "reclame", "advertentie"},
 }
@@ -0,0 +1,246 @@
+package converter
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/budget"
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+)
+
+// Chunk is a part of a Markdown document small enough for a model input.
+type Chunk struct {
+	// Breadcrumb is the titles of the headings the chunk falls under,
+	// outermost first
+	Breadcrumb []string `json:"breadcrumb,omitempty"`
+
+	// Markdown is the content of the chunk, starting with the headings of
+	// its breadcrumb
+	Markdown string `json:"markdown"`
+
+	// Tokens is the number of tokens in Markdown
+	Tokens int `json:"tokens"`
+}
+
+// ChunkOptions configures Markdown chunking. The zero value uses the
+// default chunk size without overlap.
+type ChunkOptions struct {
+	// MaxTokens is the most tokens in a chunk, including its breadcrumb
+	MaxTokens int
+
+	// Overlap is the most tokens of content repeated from the end of the
+	// previous chunk when a section is split. Whole blocks are repeated.
+	Overlap int
+
+	// Tokenizer counts tokens; they are estimated from the length of the
+	// text if nil
+	Tokenizer budget.Tokenizer
+}
+
+// heading is a Markdown heading
+type heading struct {
+	level int
+	line  string
+	title string
+}
+
+// chunkUnit is a block of Markdown with the headings it falls under
+type chunkUnit struct {
+	text    string
+	tokens  int
+	heading *heading
+	crumbs  []heading
+}
+
+// ChunkMarkdown splits Markdown into chunks of at most the maximum number of
+// tokens. Chunks break at headings once they are reasonably full, so
+// sections are kept together where possible, and otherwise between blocks;
+// blocks too large for a chunk of their own are split between words. Each
+// chunk starts with the headings it falls under, so it can be understood
+// alone.
+func ChunkMarkdown(markdown string, opts ChunkOptions) []Chunk {
+	tok := opts.Tokenizer
+	if tok == nil {
+		tok = budget.Estimator{}
+	}
+	maxTokens := opts.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = config.ChunkMaxTokens
+	}
+	separator := tok.CountTokens("\n\n")
+
+	var (
+		chunks []Chunk
+		cur    []chunkUnit
+		crumbs []heading
+		used   int
+	)
+	flush := func() {
+		if len(cur) == 0 {
+			return
+		}
+		parts := headingLines(crumbs)
+		for _, u := range cur {
+			parts = append(parts, u.text)
+		}
+		md := strings.Join(parts, "\n\n")
+
+		chunk := Chunk{Markdown: md, Tokens: tok.CountTokens(md)}
+		for _, h := range crumbs {
+			chunk.Breadcrumb = append(chunk.Breadcrumb, h.title)
+		}
+		chunks = append(chunks, chunk)
+		cur = nil
+	}
+	start := func(units []chunkUnit) {
+		cur, crumbs = units, units[0].crumbs
+		used = 0
+		if len(crumbs) > 0 {
+			used = tok.CountTokens(strings.Join(headingLines(crumbs), "\n\n")) + separator
+		}
+		for i, u := range units {
+			if i > 0 {
+				used += separator
+			}
+			used += u.tokens
+		}
+	}
+
+	for _, u := range chunkUnits(markdown, tok) {
+		if len(cur) > 0 {
+			full := used+separator+u.tokens > maxTokens
+			section := u.heading != nil && float64(used) >= config.ChunkMinFill*float64(maxTokens)
+			if !full && !section {
+				cur = append(cur, u)
+				used += separator + u.tokens
+				continue
+			}
+		}
+
+		// Content continuing a section repeats the end of the last chunk,
+		// and headings ending it move to the next, where they are part of
+		// the breadcrumb
+		var overlap []chunkUnit
+		if u.heading == nil {
+			for len(cur) > 0 && cur[len(cur)-1].heading != nil {
+				cur = cur[:len(cur)-1]
+			}
+			overlap = overlapUnits(cur, u.crumbs, opts.Overlap, separator)
+		}
+		flush()
+
+		start(append(overlap, u))
+		if used <= maxTokens {
+			continue
+		}
+		start([]chunkUnit{u})
+		if used <= maxTokens {
+			continue
+		}
+
+		// Split blocks too large for a chunk, keeping the last piece open
+		// for what follows
+		avail := maxTokens - (used - u.tokens)
+		if avail <= 0 {
+			u.crumbs = nil
+			avail = maxTokens
+		}
+		pieces := splitWords(u.text, tok, avail)
+		for i, piece := range pieces {
+			start([]chunkUnit{{text: piece, tokens: tok.CountTokens(piece), crumbs: u.crumbs}})
+			if i < len(pieces)-1 {
+				flush()
+			}
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+// chunkUnits splits Markdown into blocks, recording the headings each falls
+// under
+func chunkUnits(markdown string, tok budget.Tokenizer) []chunkUnit {
+	var (
+		units []chunkUnit
+		stack []heading
+	)
+	for _, text := range budget.SplitBlocks(markdown) {
+		u := chunkUnit{text: text, tokens: tok.CountTokens(text)}
+
+		if h, ok := parseHeading(text); ok {
+			for len(stack) > 0 && stack[len(stack)-1].level >= h.level {
+				stack = stack[:len(stack)-1]
+			}
+			u.heading = &h
+			u.crumbs = slices.Clone(stack)
+			stack = append(stack, h)
+		} else {
+			u.crumbs = slices.Clone(stack)
+		}
+
+		units = append(units, u)
+	}
+
+	return units
+}
+
+// parseHeading parses an ATX or setext heading, such as "## Requirements"
+func parseHeading(text string) (heading, bool) {
+	level, title, ok := budget.ParseHeading(text)
+	if !ok {
+		return heading{}, false
+	}
+
+	return heading{level: level, line: strings.TrimSpace(text), title: title}, true
+}
+
+// overlapUnits returns the last blocks of a chunk, up to the overlap in
+// tokens, that fall under the same headings as the next block and are not
+// headings themselves
+func overlapUnits(units []chunkUnit, crumbs []heading, overlap, separator int) []chunkUnit {
+	var (
+		n    int
+		used int
+	)
+	for i := len(units) - 1; i >= 0; i-- {
+		u := units[i]
+		if u.heading != nil || !slices.Equal(u.crumbs, crumbs) || used+u.tokens+separator > overlap {
+			break
+		}
+		used += u.tokens + separator
+		n++
+	}
+
+	return slices.Clone(units[len(units)-n:])
+}
+
+// headingLines returns the Markdown lines of headings
+func headingLines(headings []heading) []string {
+	lines := make([]string, 0, len(headings))
+	for _, h := range headings {
+		lines = append(lines, h.line)
+	}
+
+	return lines
+}
+
+// splitWords splits text into pieces of at most the given number of tokens,
+// between words. Words too long for a piece are kept whole.
+func splitWords(text string, tok budget.Tokenizer, maxTokens int) []string {
+	var pieces []string
+	for rest := strings.TrimSpace(text); rest != ""; {
+		piece := budget.Truncate(rest, tok, maxTokens)
+		if piece == "" {
+			piece = rest
+			if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+				piece = rest[:i]
+			}
+		}
+		pieces = append(pieces, piece)
+		rest = strings.TrimLeftFunc(rest[len(piece):], unicode.IsSpace)
+	}
+
+	return pieces
+}
@@ -3,18 +3,63 @@ package converter
 
 import (
 	"fmt"
+)
+
+// Format is an output format for converted content.
+type Format int
+
+const (
+	// Markdown is GitHub-flavoured Markdown
+	Markdown Format = iota
+
+	// Text is plain text with paragraphs, lists and tables kept apart
+	Text
 
-	md "github.com/JohannesKaufmann/html-to-markdown"
-	"github.com/JohannesKaufmann/html-to-markdown/plugin"
+	// JSON is a simplified DOM tree of headings, paragraphs, lists, tables
+	// and links
+	JSON
+
+	// HTML is the cleaned HTML as it is
+	HTML
 )
 
-// ToMarkdown converts HTML content to Markdown format
-func ToMarkdown(htmlContent string) (string, error) {
-	// Create a new converter
-	converter := md.NewConverter("", true, nil)
+// ParseFormat parses an output format name, as used on the command line.
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "markdown", "md", "":
+		return Markdown, nil
+	case "text", "txt":
+		return Text, nil
+	case "json":
+		return JSON, nil
+	case "html":
+		return HTML, nil
+	default:
+		return Markdown, fmt.Errorf("unknown output format %q (want markdown, text, json or html)", name)
+	}
+}
+
+// Convert converts HTML content to the given format, using the options for
+// Markdown
+func Convert(htmlContent string, format Format, opts Options) (string, error) {
+	switch format {
+	case Text:
+		return ToText(htmlContent)
+	case JSON:
+		return ToJSON(htmlContent)
+	case HTML:
+		return htmlContent, nil
+	default:
+		return ToMarkdown(htmlContent, opts)
+	}
+}
 
-	// Add GitHub-flavored Markdown plugins
-	converter.Use(plugin.GitHubFlavored())
+// ToMarkdown converts HTML content to Markdown format
+func ToMarkdown(htmlContent string, opts Options) (string, error) {
+	converter, err := newMarkdownConverter(opts)
+	if err != nil {
+		return "", err
+	}
 
 	// Convert HTML to Markdown
 	markdown, err := converter.ConvertString(htmlContent)
@@ -0,0 +1,51 @@
+package converter
+
+import (
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// definitionListRules convert dl, dt and dd elements to the definition list
+// syntax of Markdown Extra and Pandoc, with each term on its own line and
+// each definition below it prefixed with a colon
+func definitionListRules() []md.Rule {
+	return []md.Rule{
+		{
+			Filter: []string{"dl"},
+			Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+				return md.String("\n\n" + strings.TrimSpace(content) + "\n\n")
+			},
+		},
+		{
+			Filter: []string{"dt"},
+			Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+				term := strings.Join(strings.Fields(content), " ")
+				if term == "" {
+					return md.String("")
+				}
+
+				// Terms after a definition start a new group
+				prefix := ""
+				if selec.Prev().Is("dd") {
+					prefix = "\n"
+				}
+				return md.String(prefix + term + "\n")
+			},
+		},
+		{
+			Filter: []string{"dd"},
+			Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+				definition := strings.TrimSpace(content)
+				if definition == "" {
+					return md.String("")
+				}
+
+				// Continuation lines are indented to stay in the definition
+				definition = strings.ReplaceAll(definition, "\n", "\n    ")
+				return md.String(": " + definition + "\n")
+			},
+		},
+	}
+}
@@ -0,0 +1,405 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// Document is a simplified DOM of cleaned HTML: its blocks of content in
+// order, without styling or layout elements.
+type Document struct {
+	Blocks []Block `json:"blocks"`
+}
+
+// Block is a heading, paragraph, list, table, quote, code block or
+// definition list, or a part of one such as a list item or table cell.
+type Block struct {
+	// Type is heading, paragraph, list, item, table, row, header_cell, cell,
+	// quote, code, definition_list, term or definition
+	Type string `json:"type"`
+
+	// Position is the index of the block in document order, counting nested
+	// blocks
+	Position int `json:"position"`
+
+	// Level is the level of a heading, from 1 to 6
+	Level int `json:"level,omitempty"`
+
+	// Ordered is set on numbered lists
+	Ordered bool `json:"ordered,omitempty"`
+
+	// Text is the text of the block, outside any nested blocks, with
+	// whitespace collapsed except for line breaks
+	Text string `json:"text,omitempty"`
+
+	// Links are the links in Text
+	Links []Link `json:"links,omitempty"`
+
+	// Children are the nested blocks: list items, table rows and cells, and
+	// blocks within items, cells and quotes
+	Children []Block `json:"children,omitempty"`
+}
+
+// Link is a link within the text of a block.
+type Link struct {
+	Text string `json:"text"`
+	Href string `json:"href"`
+
+	// Offset is the position of the link text within the block text, in
+	// characters
+	Offset int `json:"offset"`
+}
+
+// transparentElements group blocks without being blocks themselves
+var transparentElements = map[string]bool{
+	"html":     true,
+	"body":     true,
+	"main":     true,
+	"article":  true,
+	"section":  true,
+	"div":      true,
+	"header":   true,
+	"footer":   true,
+	"nav":      true,
+	"aside":    true,
+	"figure":   true,
+	"form":     true,
+	"fieldset": true,
+	"address":  true,
+	"center":   true,
+}
+
+// paragraphElements hold a block of text
+var paragraphElements = map[string]bool{
+	"p":          true,
+	"figcaption": true,
+	"caption":    true,
+	"legend":     true,
+}
+
+// headingLevels are the levels of heading elements
+var headingLevels = map[string]int{
+	"h1": 1,
+	"h2": 2,
+	"h3": 3,
+	"h4": 4,
+	"h5": 5,
+	"h6": 6,
+}
+
+// ToJSON converts HTML content to a simplified JSON DOM tree
+func ToJSON(htmlContent string) (string, error) {
+	doc, err := ToDocument(htmlContent)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal document: %v", err)
+	}
+
+	return string(b), nil
+}
+
+// ToDocument parses HTML content into a simplified DOM tree
+func ToDocument(htmlContent string) (*Document, error) {
+	root, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	doc := &Document{Blocks: blocks(root)}
+	var position int
+	numberBlocks(doc.Blocks, &position)
+
+	return doc, nil
+}
+
+// blocks returns the blocks within n, gathering runs of loose inline
+// content into paragraphs
+func blocks(n *html.Node) []Block {
+	var (
+		blocks []Block
+		loose  []*html.Node
+	)
+	flush := func() {
+		if len(loose) == 0 {
+			return
+		}
+		var t inlineText
+		for _, c := range loose {
+			t.add(c)
+		}
+		if text, links := t.result(); text != "" {
+			blocks = append(blocks, Block{Type: "paragraph", Text: text, Links: links})
+		}
+		loose = nil
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !isBlock(c) {
+			loose = append(loose, c)
+			continue
+		}
+		flush()
+		blocks = append(blocks, block(c)...)
+	}
+	flush()
+
+	return blocks
+}
+
+// block returns the blocks of a block element; transparent elements give
+// the blocks within them
+func block(n *html.Node) []Block {
+	switch {
+	case transparentElements[n.Data]:
+		return blocks(n)
+	case headingLevels[n.Data] > 0:
+		blk := container("heading", n)
+		blk.Level = headingLevels[n.Data]
+		return nonEmpty(blk)
+	case paragraphElements[n.Data]:
+		return nonEmpty(container("paragraph", n))
+	}
+
+	switch n.Data {
+	case "ul", "ol", "menu":
+		list := Block{Type: "list", Ordered: n.Data == "ol"}
+		list.Children = parts(n, map[string]string{"li": "item"})
+		return nonEmpty(list)
+	case "table":
+		table := Block{Type: "table"}
+		for _, tr := range tableRows(n) {
+			row := Block{Type: "row"}
+			row.Children = parts(tr, map[string]string{"th": "header_cell", "td": "cell"})
+			table.Children = append(table.Children, nonEmpty(row)...)
+		}
+		return nonEmpty(table)
+	case "dl":
+		dl := Block{Type: "definition_list"}
+		dl.Children = parts(n, map[string]string{"dt": "term", "dd": "definition"})
+		return nonEmpty(dl)
+	case "blockquote":
+		return nonEmpty(container("quote", n))
+	case "pre":
+		return nonEmpty(Block{Type: "code", Text: strings.Trim(textContent(n), "\n")})
+	case "hr":
+		return nil
+	}
+
+	// Parts outside their parent, such as stray list items, are kept as
+	// paragraphs
+	return nonEmpty(container("paragraph", n))
+}
+
+// container returns a block with the inline content of n as its text and
+// the block content as its children
+func container(typ string, n *html.Node) Block {
+	blk := Block{Type: typ}
+
+	var t inlineText
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !isBlock(c) {
+			t.add(c)
+		}
+	}
+	blk.Text, blk.Links = t.result()
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if isBlock(c) {
+			blk.Children = append(blk.Children, block(c)...)
+		}
+	}
+
+	return blk
+}
+
+// parts returns the child elements of n with the given tags as blocks of
+// the mapped types, such as the items of a list
+func parts(n *html.Node, types map[string]string) []Block {
+	var parts []Block
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if typ, ok := types[c.Data]; ok {
+			parts = append(parts, container(typ, c))
+		} else if isBlock(c) {
+			parts = append(parts, block(c)...)
+		}
+	}
+
+	return parts
+}
+
+// numberBlocks sets the positions of blocks and their children in
+// document order
+func numberBlocks(blocks []Block, position *int) {
+	for i := range blocks {
+		blocks[i].Position = *position
+		*position++
+		numberBlocks(blocks[i].Children, position)
+	}
+}
+
+// nonEmpty returns the block unless it has no text or children
+func nonEmpty(blk Block) []Block {
+	if blk.Text == "" && len(blk.Children) == 0 {
+		return nil
+	}
+
+	return []Block{blk}
+}
+
+// isBlock reports whether a node is a block element rather than inline content
+func isBlock(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if transparentElements[n.Data] || paragraphElements[n.Data] || headingLevels[n.Data] > 0 {
+		return true
+	}
+
+	switch n.Data {
+	case "ul", "ol", "menu", "li", "table", "thead", "tbody", "tfoot", "tr", "th", "td",
+		"dl", "dt", "dd", "blockquote", "pre", "hr":
+		return true
+	}
+
+	return false
+}
+
+// tableRows returns the rows of a table, excluding those of nested tables
+func tableRows(t *html.Node) []*html.Node {
+	var rows []*html.Node
+	for c := t.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "tr":
+			rows = append(rows, c)
+		case "thead", "tbody", "tfoot":
+			for r := c.FirstChild; r != nil; r = r.NextSibling {
+				if r.Type == html.ElementNode && r.Data == "tr" {
+					rows = append(rows, r)
+				}
+			}
+		}
+	}
+
+	return rows
+}
+
+// inlineText collects the text and links of inline content, collapsing
+// whitespace
+type inlineText struct {
+	sb    strings.Builder
+	runes int
+	space bool
+	links []Link
+
+	// pending holds the indexes of links whose text has not started
+	pending []int
+}
+
+// add adds an inline node and its content
+func (t *inlineText) add(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		t.write(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch n.Data {
+	case "br":
+		t.sb.WriteByte('\n')
+		t.runes++
+		t.space = false
+		return
+	case "img":
+		return
+	case "a":
+		href := attr(n, "href")
+		if href == "" {
+			break
+		}
+		t.links = append(t.links, Link{
+			Text:   strings.Join(strings.Fields(textContent(n)), " "),
+			Href:   href,
+			Offset: -1,
+		})
+		t.pending = append(t.pending, len(t.links)-1)
+		defer t.start()
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		t.add(c)
+	}
+}
+
+// write adds text, collapsing runs of whitespace to a single space and
+// dropping leading and trailing whitespace
+func (t *inlineText) write(s string) {
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			t.space = true
+			continue
+		}
+		if t.space && t.sb.Len() > 0 && !strings.HasSuffix(t.sb.String(), "\n") {
+			t.sb.WriteByte(' ')
+			t.runes++
+		}
+		t.space = false
+		t.start()
+		t.sb.WriteRune(r)
+		t.runes++
+	}
+}
+
+// start sets the offset of links whose text starts at the current position
+func (t *inlineText) start() {
+	for _, i := range t.pending {
+		t.links[i].Offset = t.runes
+	}
+	t.pending = t.pending[:0]
+}
+
+// result returns the collected text and links
+func (t *inlineText) result() (string, []Link) {
+	return strings.TrimRight(t.sb.String(), "\n"), t.links
+}
+
+// attr returns the trimmed value of an attribute
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+
+	return ""
+}
+
+// textContent returns the text within a node
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+
+	return sb.String()
+}
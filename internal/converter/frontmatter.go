@@ -0,0 +1,17 @@
+package converter
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WithFrontMatter prepends YAML front matter describing the content to the Markdown
+func WithFrontMatter(markdown string, v any) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal front matter: %v", err)
+	}
+
+	return "---\n" + string(b) + "---\n\n" + markdown, nil
+}
@@ -0,0 +1,321 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/budget"
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+)
+
+// Normalisation rules, as named in a report
+const (
+	ruleBlankLine      = "blank-line"
+	ruleEscape         = "escape"
+	ruleEmptyListItem  = "empty-list-item"
+	ruleDuplicateLink  = "duplicate-link"
+	ruleLinkFarm       = "link-farm"
+	ruleDuplicateBlock = "duplicate-block"
+)
+
+// NormalisationReport describes what normalisation removed from Markdown.
+type NormalisationReport struct {
+	BytesBefore  int `json:"bytes_before"`
+	BytesAfter   int `json:"bytes_after"`
+	TokensBefore int `json:"tokens_before"`
+	TokensAfter  int `json:"tokens_after"`
+
+	// Removed counts the removals made by each normalisation rule: blank
+	// lines, escapes, empty list items, duplicate links, links in collapsed
+	// link lists and duplicate blocks
+	Removed map[string]int `json:"removed,omitempty"`
+
+	// DuplicateBlocks holds an excerpt of each removed duplicate block
+	DuplicateBlocks []string `json:"duplicate_blocks,omitempty"`
+}
+
+var (
+	// listItemPattern matches the marker of a list item
+	listItemPattern = regexp.MustCompile(`^[ \t]*(?:[-*+]|\d+[.)])(?:[ \t]+|$)`)
+
+	// containerPattern matches the quote and list markers starting a line
+	containerPattern = regexp.MustCompile(`^[ \t]*(?:>[ \t]*)*(?:(?:[-*+]|\d+[.)])[ \t]+)?`)
+
+	// linkPattern matches inline and reference links and images, including
+	// images within link text
+	linkPattern = regexp.MustCompile(`!?\[(?:\\.|!\[(?:\\.|[^\]\\])*\]\([^)]*\)|[^\]\\])*\](?:\((?:[^()\s]|\([^()]*\))*(?:\s+"[^"]*")?\)|\[[^\]]*\])`)
+
+	// linkSeparatorPattern matches what may separate the links of a
+	// link-only line
+	linkSeparatorPattern = regexp.MustCompile(`^[\s|·•,/-]*$`)
+)
+
+// Normalise tidies converted Markdown: repeated blank lines are collapsed,
+// escapes that are not needed, empty list items and repeated consecutive
+// links are removed, long link-only lists are cut short and repeated
+// boilerplate blocks, such as navigation and notices, are kept once. Other
+// repeated blocks are content, such as the same requirement in two roles,
+// so are kept. Fenced code is left as it is.
+func Normalise(markdown string) (string, *NormalisationReport) {
+	tok := budget.Estimator{}
+	r := &NormalisationReport{
+		BytesBefore:  len(markdown),
+		TokensBefore: tok.CountTokens(markdown),
+		Removed:      make(map[string]int),
+	}
+
+	// Blank lines outside blocks beyond those separating them are removed
+	blocks := budget.SplitBlocks(markdown)
+	blank := blankLines(markdown)
+	for _, b := range blocks {
+		blank -= blankLines(b)
+	}
+	if extra := blank - max(len(blocks)-1, 0); extra > 0 {
+		r.Removed[ruleBlankLine] = extra
+	}
+
+	var (
+		kept []string
+		seen = make(map[string]bool)
+	)
+	for _, b := range blocks {
+		if b = normaliseBlock(b, r); b == "" {
+			continue
+		}
+
+		key := strings.ToLower(strings.Join(strings.Fields(b), " "))
+		if len(key) >= config.DuplicateBlockMinLength && budget.Boilerplate(b) {
+			if seen[key] {
+				r.Removed[ruleDuplicateBlock]++
+				r.DuplicateBlocks = append(r.DuplicateBlocks, blockExcerpt(strings.Join(strings.Fields(b), " ")))
+				continue
+			}
+			seen[key] = true
+		}
+
+		kept = append(kept, b)
+	}
+
+	normalised := strings.Join(kept, "\n\n")
+	r.BytesAfter, r.TokensAfter = len(normalised), tok.CountTokens(normalised)
+
+	return normalised, r
+}
+
+// normaliseBlock normalises the lines of a block outside fenced code and
+// collapses it if it is a link farm, returning an empty string if nothing
+// is left
+func normaliseBlock(block string, r *NormalisationReport) string {
+	var (
+		lines = strings.Split(block, "\n")
+		kept  []string
+		fence string
+	)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			kept = append(kept, line)
+			continue
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+			kept = append(kept, line)
+			continue
+		}
+
+		// Empty items holding nested lists are kept for their children
+		if m := listItemPattern.FindString(line); m != "" && strings.TrimSpace(line[len(m):]) == "" {
+			if i+1 >= len(lines) || indentation(lines[i+1]) <= indentation(line) {
+				r.Removed[ruleEmptyListItem]++
+				continue
+			}
+		}
+
+		kept = append(kept, dedupeLinks(unescape(line, r), r))
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+
+	return collapseLinkFarm(kept, r)
+}
+
+// unescape removes backslash escapes that are not needed where they are,
+// outside code spans
+func unescape(line string, r *NormalisationReport) string {
+	start := len(containerPattern.FindString(line))
+
+	var sb strings.Builder
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case '\\':
+			if i+1 >= len(line) {
+				break
+			}
+			if !neededEscape(line, i, start) {
+				sb.WriteByte(line[i+1])
+				r.Removed[ruleEscape]++
+			} else {
+				sb.WriteString(line[i : i+2])
+			}
+			i += 2
+			continue
+		case '`':
+			n := len(line[i:]) - len(strings.TrimLeft(line[i:], "`"))
+			end := i + n
+			if j := strings.Index(line[end:], line[i:i+n]); j >= 0 {
+				end += j + n
+			}
+			sb.WriteString(line[i:end])
+			i = end
+			continue
+		}
+		sb.WriteByte(line[i])
+		i++
+	}
+
+	return sb.String()
+}
+
+// neededEscape reports whether the backslash at i escapes a character that
+// would otherwise be Markdown syntax. The converter escapes characters at the
+// start of each text node as if it started a line; after other text on the
+// line, they are plain text.
+func neededEscape(line string, i, start int) bool {
+	before := ""
+	if i > start {
+		before = strings.TrimSpace(line[start:i])
+	}
+	midLine := strings.IndexFunc(before, isWordRune) >= 0
+
+	prev, _ := utf8.DecodeLastRuneInString(line[:i])
+	next, _ := utf8.DecodeRuneInString(line[i+2:])
+	if i == 0 {
+		prev = ' '
+	}
+	if i+2 >= len(line) {
+		next = ' '
+	}
+
+	switch line[i+1] {
+	case '_':
+		// Underscores within words and between spaces never emphasise
+		if isWordRune(prev) && isWordRune(next) {
+			return false
+		}
+		return !(midLine && unicode.IsSpace(prev) && unicode.IsSpace(next))
+	case '*':
+		return !(midLine && unicode.IsSpace(prev) && unicode.IsSpace(next))
+	case '-', '+', '#', '>':
+		return !midLine
+	case '.':
+		// A number at the start of a line followed by a dot is a list item
+		return before != "" && strings.Trim(before, "0123456789") == ""
+	case '|':
+		// Only table rows give pipes a meaning
+		return strings.HasPrefix(strings.TrimSpace(line), "|")
+	default:
+		return true
+	}
+}
+
+// dedupeLinks removes links repeating the link before them, with only
+// separators between
+func dedupeLinks(line string, r *NormalisationReport) string {
+	locs := linkPattern.FindAllStringIndex(line, -1)
+	if len(locs) < 2 {
+		return line
+	}
+
+	var (
+		sb   strings.Builder
+		last int
+		prev = locs[0]
+		end  = locs[0][1]
+	)
+	for _, loc := range locs[1:] {
+		if line[loc[0]:loc[1]] == line[prev[0]:prev[1]] && linkSeparatorPattern.MatchString(line[end:loc[0]]) {
+			sb.WriteString(line[last:end])
+			last, end = loc[1], loc[1]
+			r.Removed[ruleDuplicateLink]++
+			continue
+		}
+		prev, end = loc, loc[1]
+	}
+	sb.WriteString(line[last:])
+
+	return sb.String()
+}
+
+// collapseLinkFarm cuts lists of many items holding only links, such as
+// navigation menus, down to their first items
+func collapseLinkFarm(lines []string, r *NormalisationReport) string {
+	block := strings.Join(lines, "\n")
+	if len(lines) < config.LinkFarmMinLinks {
+		return block
+	}
+
+	for _, line := range lines {
+		m := listItemPattern.FindString(line)
+		if m == "" {
+			return block
+		}
+		content := line[len(m):]
+		if !linkPattern.MatchString(content) || !linkSeparatorPattern.MatchString(linkPattern.ReplaceAllString(content, "")) {
+			return block
+		}
+	}
+
+	var removed int
+	for _, line := range lines[config.LinkFarmKeepLinks:] {
+		removed += len(linkPattern.FindAllString(line, -1))
+	}
+	r.Removed[ruleLinkFarm] += removed
+
+	marker := listItemPattern.FindString(lines[0])
+	kept := append(lines[:config.LinkFarmKeepLinks:config.LinkFarmKeepLinks], fmt.Sprintf("%s… %d more links", marker, removed))
+
+	return strings.Join(kept, "\n")
+}
+
+// blockExcerpt shortens the text of a block for a report, cutting it
+// between runes
+func blockExcerpt(text string) string {
+	if utf8.RuneCountInString(text) <= config.ReportExcerptLength {
+		return text
+	}
+
+	return string([]rune(text)[:config.ReportExcerptLength]) + "…"
+}
+
+// blankLines counts the lines of text holding only whitespace
+func blankLines(text string) int {
+	if text == "" {
+		return 0
+	}
+
+	var n int
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// indentation returns the width of the leading whitespace of a line
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// isWordRune reports whether a rune is a letter or digit
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
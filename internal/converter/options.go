@@ -0,0 +1,250 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/JohannesKaufmann/html-to-markdown/plugin"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"gopkg.in/yaml.v3"
+)
+
+// Options configures Markdown conversion, from the command line or a YAML or
+// JSON file. The zero value gives ATX headings, "-" bullets, inline links and
+// code blocks fenced with backticks, keeping images and links.
+type Options struct {
+	// HeadingStyle is atx ("# Title") or setext (underlined titles)
+	HeadingStyle string `json:"heading_style,omitempty" yaml:"heading_style,omitempty"`
+
+	// BulletMarker is the list item marker: "-", "*" or "+"
+	BulletMarker string `json:"bullet_marker,omitempty" yaml:"bullet_marker,omitempty"`
+
+	// LinkStyle is inline, with URLs in the text, or reference, with URLs
+	// listed at the end
+	LinkStyle string `json:"link_style,omitempty" yaml:"link_style,omitempty"`
+
+	// CodeFence is the fence of code blocks: backticks or tildes
+	CodeFence string `json:"code_fence,omitempty" yaml:"code_fence,omitempty"`
+
+	// DropImages removes images
+	DropImages bool `json:"drop_images,omitempty" yaml:"drop_images,omitempty"`
+
+	// DropLinks replaces links with their text
+	DropLinks bool `json:"drop_links,omitempty" yaml:"drop_links,omitempty"`
+
+	// Rules are custom conversions of the elements matching CSS selectors,
+	// applied in order
+	Rules []Rule `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// Rule converts the elements matching a CSS selector, such as turning salary
+// badges into bold text.
+type Rule struct {
+	// Selector is a CSS selector for the elements converted
+	Selector string `json:"selector" yaml:"selector"`
+
+	// Action is bold, italic or code to give the text of the elements that
+	// formatting, text to give it as plain text, or remove
+	Action string `json:"action" yaml:"action"`
+}
+
+// ruleActions are the elements wrapping the text of matched elements for
+// each rule action; an empty element gives plain text, and removed elements
+// give nothing
+var ruleActions = map[string]string{
+	"bold":   "strong",
+	"italic": "em",
+	"code":   "code",
+	"text":   "",
+	"remove": "",
+}
+
+// LoadOptions reads conversion options from a YAML or JSON file and checks
+// that they are valid.
+func LoadOptions(path string) (Options, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Options{}, fmt.Errorf("failed to read conversion options: %w", err)
+	}
+
+	// JSON is valid YAML, so one decoder handles both
+	var o Options
+	if err := yaml.Unmarshal(b, &o); err != nil {
+		return Options{}, fmt.Errorf("failed to parse conversion options: %w", err)
+	}
+
+	if err := o.Validate(); err != nil {
+		return Options{}, err
+	}
+
+	return o, nil
+}
+
+// Validate checks the option values and rule selectors.
+func (o Options) Validate() error {
+	if _, err := o.markdownOptions(); err != nil {
+		return err
+	}
+
+	return o.validateRules()
+}
+
+// markdownOptions maps the options to those of the Markdown converter
+func (o Options) markdownOptions() (*md.Options, error) {
+	opts := &md.Options{}
+
+	switch o.HeadingStyle {
+	case "", "atx", "setext":
+		opts.HeadingStyle = o.HeadingStyle
+	default:
+		return nil, fmt.Errorf("unknown heading style %q (want atx or setext)", o.HeadingStyle)
+	}
+
+	switch o.BulletMarker {
+	case "", "-", "*", "+":
+		opts.BulletListMarker = o.BulletMarker
+	default:
+		return nil, fmt.Errorf("unknown bullet marker %q (want -, * or +)", o.BulletMarker)
+	}
+
+	switch o.LinkStyle {
+	case "", "inline":
+		opts.LinkStyle = "inlined"
+	case "reference":
+		opts.LinkStyle = "referenced"
+	default:
+		return nil, fmt.Errorf("unknown link style %q (want inline or reference)", o.LinkStyle)
+	}
+
+	switch o.CodeFence {
+	case "", "backticks":
+		opts.Fence = "```"
+	case "tildes":
+		opts.Fence = "~~~"
+	default:
+		return nil, fmt.Errorf("unknown code fence %q (want backticks or tildes)", o.CodeFence)
+	}
+
+	return opts, nil
+}
+
+// validateRules checks the selectors and actions of the rules
+func (o Options) validateRules() error {
+	for _, r := range o.Rules {
+		if _, ok := ruleActions[r.Action]; !ok {
+			return fmt.Errorf("unknown action %q for selector %q (want bold, italic, code, text or remove)", r.Action, r.Selector)
+		}
+		if _, err := cascadia.ParseGroup(r.Selector); err != nil {
+			return fmt.Errorf("invalid selector %q: %v", r.Selector, err)
+		}
+	}
+
+	return nil
+}
+
+// newMarkdownConverter returns a GitHub-flavoured Markdown converter with the
+// options applied
+func newMarkdownConverter(o Options) (*md.Converter, error) {
+	opts, err := o.markdownOptions()
+	if err != nil {
+		return nil, err
+	}
+	if err := o.validateRules(); err != nil {
+		return nil, err
+	}
+
+	converter := md.NewConverter("", true, opts)
+
+	// Add GitHub-flavored Markdown plugins
+	converter.Use(plugin.GitHubFlavored())
+
+	// Keep terms and definitions apart
+	converter.AddRules(definitionListRules()...)
+
+	// Custom rules and dropped elements change the HTML before conversion
+	converter.Before(func(selec *goquery.Selection) {
+		for _, r := range o.Rules {
+			selec.Find(r.Selector).Each(func(_ int, s *goquery.Selection) {
+				applyRule(s, r.Action)
+			})
+		}
+		if o.DropImages {
+			selec.Find("img").Remove()
+		}
+		if o.DropLinks {
+			// Links become spans rather than being unwrapped, which would
+			// lose the spaces around them
+			for _, n := range selec.Find("a").Nodes {
+				n.Data, n.DataAtom, n.Attr = "span", atom.Span, nil
+			}
+		}
+		keepSpanSpacing(selec)
+	})
+
+	return converter, nil
+}
+
+// keepSpanSpacing moves whitespace following a span onto the end of its
+// text, or the start of the text of a span after it. The converter drops
+// whitespace-only text, which only elements with their own rules, unlike
+// spans, make up for, joining the words either side.
+func keepSpanSpacing(selec *goquery.Selection) {
+	for _, n := range selec.Find("span").Nodes {
+		ws := n.NextSibling
+		if ws == nil || ws.Type != html.TextNode || strings.TrimSpace(ws.Data) != "" || ws.NextSibling == nil {
+			continue
+		}
+
+		if t := spanText(n, func(c *html.Node) *html.Node { return c.LastChild }); t != nil {
+			t.Data += ws.Data
+		} else if t := spanText(ws.NextSibling, func(c *html.Node) *html.Node { return c.FirstChild }); t != nil {
+			t.Data = ws.Data + t.Data
+		} else {
+			continue
+		}
+		n.Parent.RemoveChild(ws)
+	}
+}
+
+// spanText returns the text node at the edge of a span, following child
+// through any nested spans, or nil if the edge is another element
+func spanText(n *html.Node, child func(*html.Node) *html.Node) *html.Node {
+	for n != nil && n.Type == html.ElementNode && n.Data == "span" {
+		n = child(n)
+	}
+	if n == nil || n.Type != html.TextNode {
+		return nil
+	}
+
+	return n
+}
+
+// applyRule converts an element matched by a custom rule
+func applyRule(s *goquery.Selection, action string) {
+	if action == "remove" {
+		s.Remove()
+		return
+	}
+
+	text := strings.Join(strings.Fields(s.Text()), " ")
+	if text == "" {
+		s.Remove()
+		return
+	}
+
+	replacement := html.EscapeString(text)
+	if tag := ruleActions[action]; tag != "" {
+		replacement = "<" + tag + ">" + replacement + "</" + tag + ">"
+	}
+
+	// Block elements keep their own line
+	if isBlock(s.Get(0)) {
+		replacement = "<p>" + replacement + "</p>"
+	}
+	s.ReplaceWithHtml(replacement)
+}
@@ -0,0 +1,96 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToText converts HTML content to plain text, keeping paragraphs apart and
+// lists, tables and definition lists on their own lines
+func ToText(htmlContent string) (string, error) {
+	doc, err := ToDocument(htmlContent)
+	if err != nil {
+		return "", err
+	}
+
+	return textBlocks(doc.Blocks), nil
+}
+
+// textBlocks renders blocks separated by blank lines
+func textBlocks(blocks []Block) string {
+	parts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		if text := textBlock(b); text != "" {
+			parts = append(parts, text)
+		}
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// textBlock renders a block as plain text
+func textBlock(b Block) string {
+	switch b.Type {
+	case "list":
+		items := make([]string, 0, len(b.Children))
+		for i, item := range b.Children {
+			marker := "- "
+			if b.Ordered {
+				marker = fmt.Sprintf("%d. ", i+1)
+			}
+			text := joinText(item.Text, textBlocks(item.Children), "\n")
+			items = append(items, marker+indent(text, strings.Repeat(" ", len(marker))))
+		}
+		return strings.Join(items, "\n")
+	case "table":
+		rows := make([]string, 0, len(b.Children))
+		for _, row := range b.Children {
+			cells := make([]string, 0, len(row.Children))
+			for _, cell := range row.Children {
+				text := joinText(cell.Text, textBlocks(cell.Children), " ")
+				cells = append(cells, strings.Join(strings.Fields(text), " "))
+			}
+			rows = append(rows, strings.Join(cells, " | "))
+		}
+		return strings.Join(rows, "\n")
+	case "definition_list":
+		lines := make([]string, 0, len(b.Children))
+		for _, part := range b.Children {
+			text := joinText(part.Text, textBlocks(part.Children), "\n")
+			if part.Type == "definition" {
+				text = "  " + indent(text, "  ")
+			}
+			lines = append(lines, text)
+		}
+		return strings.Join(lines, "\n")
+	case "quote":
+		text := joinText(b.Text, textBlocks(b.Children), "\n\n")
+		return "  " + indent(text, "  ")
+	default:
+		return joinText(b.Text, textBlocks(b.Children), "\n\n")
+	}
+}
+
+// joinText joins the text of a block with that of its children
+func joinText(text, children, sep string) string {
+	switch {
+	case text == "":
+		return children
+	case children == "":
+		return text
+	default:
+		return text + sep + children
+	}
+}
+
+// indent indents every line after the first that is not empty
+func indent(text, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = prefix + lines[i]
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
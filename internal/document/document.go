@@ -0,0 +1,99 @@
+// Package document provides functionality to convert non-HTML documents, such as PDF and DOCX job descriptions, to Markdown
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Type is a supported non-HTML document type.
+type Type string
+
+const (
+	Unknown Type = ""
+	PDF     Type = "pdf"
+	DOCX    Type = "docx"
+)
+
+// Content types for supported document types.
+const (
+	PDFContentType  = "application/pdf"
+	DOCXContentType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+)
+
+// Detect determines the document type from its content type header and
+// leading bytes. Servers often send generic content types for downloads, so
+// the content itself is checked when the header is inconclusive.
+func Detect(contentType string, data []byte) Type {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case PDFContentType:
+		return PDF
+	case DOCXContentType:
+		return DOCX
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return PDF
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) && bytes.Contains(data, []byte(docxBodyPath)):
+		return DOCX
+	}
+
+	return Unknown
+}
+
+// DetectURL determines the document type from the file extension of a URL,
+// for when the server does not say what it is without downloading it.
+func DetectURL(rawURL string) Type {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Unknown
+	}
+
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".pdf":
+		return PDF
+	case ".docx":
+		return DOCX
+	default:
+		return Unknown
+	}
+}
+
+// ToMarkdown converts a document of the given type to Markdown.
+func ToMarkdown(t Type, data []byte) (string, error) {
+	var (
+		markdown string
+		err      error
+	)
+	switch t {
+	case PDF:
+		markdown, err = pdfToMarkdown(data)
+	case DOCX:
+		markdown, err = docxToMarkdown(data)
+	default:
+		return "", fmt.Errorf("unsupported document type")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(markdown), nil
+}
+
+// ContentType returns the content type for a document type.
+func (t Type) ContentType() string {
+	switch t {
+	case PDF:
+		return PDFContentType
+	case DOCX:
+		return DOCXContentType
+	default:
+		return ""
+	}
+}
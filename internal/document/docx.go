@@ -0,0 +1,203 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// docxBodyPath is the path of the main document part within a DOCX archive
+const docxBodyPath = "word/document.xml"
+
+// headingStyle matches paragraph style IDs used for headings
+var headingStyle = regexp.MustCompile(`(?i)^heading\s*([1-6])$`)
+
+// docxToMarkdown converts the main document part of a DOCX archive to
+// Markdown, keeping headings, lists and tables
+func docxToMarkdown(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read DOCX archive: %v", err)
+	}
+
+	for _, f := range zr.File {
+		if f.Name != docxBodyPath {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("failed to open DOCX body: %v", err)
+		}
+		defer rc.Close()
+
+		return convertDOCXBody(rc)
+	}
+
+	return "", fmt.Errorf("DOCX archive has no %s", docxBodyPath)
+}
+
+// convertDOCXBody walks the WordprocessingML body and renders it as Markdown
+func convertDOCXBody(r io.Reader) (string, error) {
+	var (
+		out        strings.Builder
+		para       strings.Builder
+		style      string
+		list       bool
+		prevList   bool
+		tableDepth int
+		cell       []string
+		row        []string
+		rows       [][]string
+	)
+
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse DOCX body: %v", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				style, list = "", false
+			case "pStyle":
+				style = attrValue(t, "val")
+			case "numPr":
+				list = true
+			case "t":
+				var text string
+				if err := d.DecodeElement(&text, &t); err != nil {
+					return "", fmt.Errorf("failed to parse DOCX text: %v", err)
+				}
+				para.WriteString(text)
+			case "tab":
+				para.WriteString(" ")
+			case "br", "cr":
+				para.WriteString("\n")
+			case "tbl":
+				tableDepth++
+				if tableDepth == 1 {
+					rows = nil
+				}
+			case "tr":
+				if tableDepth == 1 {
+					row = nil
+				}
+			case "tc":
+				if tableDepth == 1 {
+					cell = nil
+				}
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				text := strings.TrimSpace(para.String())
+				if text == "" {
+					continue
+				}
+				if tableDepth > 0 {
+					cell = append(cell, text)
+					continue
+				}
+				// Lists need a blank line before any following paragraph
+				if prevList && !list {
+					out.WriteString("\n")
+				}
+				out.WriteString(formatParagraph(text, style, list))
+				prevList = list
+			case "tc":
+				if tableDepth == 1 {
+					row = append(row, strings.Join(cell, " "))
+				}
+			case "tr":
+				if tableDepth == 1 {
+					rows = append(rows, row)
+				}
+			case "tbl":
+				tableDepth--
+				if tableDepth == 0 {
+					prevList = false
+					out.WriteString(formatTable(rows))
+				}
+			}
+		}
+	}
+
+	return out.String(), nil
+}
+
+// formatParagraph renders a paragraph as a Markdown heading, list item or
+// plain paragraph depending on its style
+func formatParagraph(text, style string, list bool) string {
+	if style == "Title" {
+		return "# " + text + "\n\n"
+	}
+	if m := headingStyle.FindStringSubmatch(style); m != nil {
+		level, _ := strconv.Atoi(m[1])
+		return strings.Repeat("#", level) + " " + text + "\n\n"
+	}
+	if list {
+		return "- " + strings.ReplaceAll(text, "\n", " ") + "\n"
+	}
+
+	return strings.ReplaceAll(text, "\n", "  \n") + "\n\n"
+}
+
+// formatTable renders table rows as a GitHub-flavored Markdown table, using
+// the first row as the header
+func formatTable(rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+
+	cols := 0
+	for _, r := range rows {
+		cols = max(cols, len(r))
+	}
+	if cols == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n")
+	for i, r := range rows {
+		cells := make([]string, cols)
+		for j := range cells {
+			if j < len(r) {
+				cells[j] = strings.ReplaceAll(strings.ReplaceAll(r[j], "|", `\|`), "\n", " ")
+			}
+		}
+		sb.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+		}
+	}
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// attrValue returns the value of the attribute with the given local name
+func attrValue(t xml.StartElement, local string) string {
+	for _, attr := range t.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,53 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pdfToMarkdown extracts the text of a PDF row by row, separating pages with
+// blank lines
+func pdfToMarkdown(data []byte) (md string, err error) {
+	// The PDF reader panics on malformed files rather than returning errors
+	defer func() {
+		if p := recover(); p != nil {
+			md, err = "", fmt.Errorf("failed to read PDF: %v", p)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read PDF: %v", err)
+	}
+
+	var sb strings.Builder
+	for i := 1; i <= r.NumPage(); i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		rows, err := page.GetTextByRow()
+		if err != nil {
+			return "", fmt.Errorf("failed to read PDF page %d: %v", i, err)
+		}
+
+		for _, row := range rows {
+			var line strings.Builder
+			for _, text := range row.Content {
+				line.WriteString(text.S)
+			}
+
+			if l := strings.TrimSpace(line.String()); l != "" {
+				sb.WriteString(l)
+				sb.WriteString("\n")
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String(), nil
+}
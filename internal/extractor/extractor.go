@@ -27,11 +27,17 @@ func NewExtractor(ctx context.Context, apiKey string) (*Extractor, error) {
 }
 
 // ExtractContent extracts content from the provided raw content using the GenAI client.
-func (e *Extractor) ExtractContent(ctx context.Context, model, schema, url, rawContent string) (string, error) {
+// Content in a language with extraction notes has them added to the prompt.
+func (e *Extractor) ExtractContent(ctx context.Context, model, schema, url, rawContent, lang string) (string, error) {
+	var notes string
+	if note, ok := config.ExtractionLanguageNotes[lang]; ok {
+		notes = "\n\n" + note
+	}
+
 	result, err := e.client.Models.GenerateContent(
 		ctx,
 		model,
-		genai.Text(fmt.Sprintf(config.ExtractionPrompt, url, rawContent, schema)),
+		genai.Text(fmt.Sprintf(config.ExtractionPrompt, url, rawContent, notes, schema)),
 		nil,
 	)
 	if err != nil {
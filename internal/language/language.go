@@ -0,0 +1,100 @@
+// Package language detects the language of page content offline, by the
+// frequency of common words
+package language
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+)
+
+// Supported languages, as ISO 639-1 codes.
+const (
+	English = "en"
+	German  = "de"
+	French  = "fr"
+	Dutch   = "nl"
+)
+
+// stopwords are common words of each supported language. Words shared by
+// several of the languages, such as "in", "de", "des" and "en", are left out so
+// each hit counts for one language only.
+var stopwords = map[string]map[string]bool{
+	English: set("the", "and", "of", "to", "with", "for", "you", "your", "are", "will", "our", "this", "that", "have", "be", "as", "on", "from", "or", "it", "by", "at", "can", "who"),
+	German:  set("und", "der", "das", "mit", "für", "sie", "wir", "ist", "ein", "eine", "zu", "den", "von", "auf", "nicht", "sind", "bei", "werden", "ihre", "unsere", "oder", "dem", "auch", "sich"),
+	French:  set("le", "la", "les", "et", "du", "un", "une", "pour", "avec", "vous", "nous", "est", "dans", "sur", "qui", "que", "au", "aux", "pas", "votre", "notre", "sont", "par", "ce"),
+	Dutch:   set("het", "een", "van", "voor", "met", "zijn", "wij", "je", "jouw", "onze", "naar", "ook", "niet", "bij", "dat", "op", "te", "uit", "wordt", "aan", "worden", "jij", "heb", "deze", "om"),
+}
+
+// Detect returns the language of text, or an empty string if there is too
+// little text or no language clearly leads.
+func Detect(text string) string {
+	if len(text) > config.LanguageSampleLength {
+		text = text[:config.LanguageSampleLength]
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) < config.LanguageMinWords {
+		return ""
+	}
+
+	hits := make(map[string]int)
+	for _, w := range words {
+		for lang, sw := range stopwords {
+			if sw[w] {
+				hits[lang]++
+			}
+		}
+	}
+
+	var best, second int
+	var lang string
+	for l, n := range hits {
+		switch {
+		case n > best:
+			best, second, lang = n, best, l
+		case n > second:
+			second = n
+		}
+	}
+	if float64(best) < config.LanguageMinRatio*float64(len(words)) || float64(best) < config.LanguageMargin*float64(second) {
+		return ""
+	}
+
+	return lang
+}
+
+// Base returns the primary language of a language tag, such as "de" for
+// "de-CH", lowercased.
+func Base(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+
+	return tag
+}
+
+// Choose returns the language detected in text, falling back to the
+// primary language of the declared tag, as pages often keep the lang
+// attribute of a template in another language.
+func Choose(declared, text string) string {
+	if lang := Detect(text); lang != "" {
+		return lang
+	}
+
+	return Base(declared)
+}
+
+// set builds a set of words
+func set(words ...string) map[string]bool {
+	s := make(map[string]bool, len(words))
+	for _, w := range words {
+		s[w] = true
+	}
+
+	return s
+}
@@ -0,0 +1,348 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/canonical"
+	"github.com/danmrichards/sandbox/toyscraper/internal/cleaner"
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"github.com/danmrichards/sandbox/toyscraper/internal/converter"
+	"github.com/danmrichards/sandbox/toyscraper/internal/language"
+	"github.com/danmrichards/sandbox/toyscraper/internal/scraper"
+)
+
+// Listing describes how detail pages are discovered from a listing page.
+//
+// Candidate links are those matching DetailSelector on the host of the
+// listing page, unless ExternalLinks is set, optionally narrowed by
+// DetailPattern and, if ClassifyLinks is set, by classifying their link text.
+type Listing struct {
+	// Pagination controls how subsequent listing pages are followed
+	Pagination scraper.Pagination
+
+	// DetailSelector is a CSS selector for detail links (default: config.DefaultDetailLinkSelector)
+	DetailSelector string
+
+	// DetailPattern, if set, must match the absolute URL of a detail link
+	DetailPattern *regexp.Regexp
+
+	// ExternalLinks allows detail links to hosts other than that of the
+	// listing page
+	ExternalLinks bool
+
+	// ClassifyLinks uses the pipeline classifier to keep only links whose
+	// text looks like a job posting
+	ClassifyLinks bool
+
+	// StripTemplates removes blocks repeated across the detail pages of a
+	// site, keeping them once as the site context of the first result. All
+	// detail pages are fetched before any is processed.
+	StripTemplates bool
+}
+
+// detailLink is a candidate detail page and the listing page it was found on
+type detailLink struct {
+	url        string
+	listingURL string
+}
+
+// RunListing scrapes a listing page, following its pagination, then runs the
+// pipeline over every detail page it links to. Each result references the
+// listing page its detail link was found on.
+//
+// Failures on individual detail pages are recorded on their result rather
+// than aborting the run.
+func (p *Pipeline) RunListing(ctx context.Context, listingURL string, l Listing) ([]*Result, error) {
+	if l.ClassifyLinks && p.Classifier == nil {
+		return nil, fmt.Errorf("link classification requires a classifier")
+	}
+
+	pagination := l.Pagination
+	if pagination.HasItems == nil {
+		pagination.HasItems = newDetailLinkCheck(l)
+	}
+
+	pages, err := scraper.GetPaginatedHTML(listingURL, p.Timeout, pagination)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape listing: %w", err)
+	}
+
+	links, err := p.detailLinks(ctx, pages, l)
+	if err != nil {
+		return nil, err
+	}
+
+	dedupe := canonical.NewDeduper()
+	results := make([]*Result, 0, len(links))
+	if !l.StripTemplates {
+		for _, link := range links {
+			r, doc := p.fetchDetail(link, dedupe)
+			if doc != nil {
+				p.processDetail(ctx, r, doc, p.Cleaning, dedupe)
+			}
+			results = append(results, r)
+		}
+		return results, nil
+	}
+
+	// Repeated blocks are only known once every page has been seen
+	tmpl := cleaner.NewTemplate()
+	docs := make([]*scraper.Document, 0, len(links))
+	for _, link := range links {
+		r, doc := p.fetchDetail(link, dedupe)
+		if doc != nil && doc.HTML != "" {
+			// Pages that cannot be learned from are still cleaned
+			_ = tmpl.Learn(doc.URL, doc.HTML)
+		}
+		results = append(results, r)
+		docs = append(docs, doc)
+	}
+
+	opts := p.Cleaning
+	opts.Template = tmpl
+	for i, r := range results {
+		if docs[i] != nil {
+			p.processDetail(ctx, r, docs[i], opts, dedupe)
+		}
+	}
+	p.addSiteContext(results, docs, tmpl)
+
+	return results, nil
+}
+
+// fetchDetail fetches a single detail page, returning no document if it
+// failed or its canonical URL has already been fetched
+func (p *Pipeline) fetchDetail(link detailLink, dedupe *canonical.Deduper) (*Result, *scraper.Document) {
+	r := &Result{URL: link.url, ListingURL: link.listingURL}
+
+	doc, err := scraper.Fetch(link.url, p.Timeout)
+	if err != nil {
+		r.Error = fmt.Sprintf("failed to scrape URL: %v", err)
+		return r, nil
+	}
+	r.ContentType = doc.ContentType
+
+	// The same posting is often reachable from several URLs
+	if doc.HTML != "" {
+		if c, err := canonical.FromHTML(link.url, doc.HTML); err == nil {
+			if seen, _ := dedupe.SeenURL(c); seen {
+				r.DuplicateOf = c
+				return r, nil
+			}
+		}
+	}
+
+	return r, doc
+}
+
+// processDetail processes a fetched detail page, skipping extraction for
+// pages whose content has already been processed
+func (p *Pipeline) processDetail(ctx context.Context, r *Result, doc *scraper.Document, opts cleaner.Options, dedupe *canonical.Deduper) {
+	if err := p.convert(doc, r, opts); err != nil {
+		r.Error = err.Error()
+		return
+	}
+	if first, dup := dedupe.SeenContent(r.URL, r.Markdown); dup {
+		r.DuplicateOf = first
+		return
+	}
+
+	if err := p.analyse(ctx, r); err != nil {
+		r.Error = err.Error()
+		return
+	}
+	if err := p.finalise(r); err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// addSiteContext converts the blocks stripped from each site and adds them
+// to the first processed result for the site
+func (p *Pipeline) addSiteContext(results []*Result, docs []*scraper.Document, tmpl *cleaner.Template) {
+	done := make(map[string]bool)
+	for i, r := range results {
+		if docs[i] == nil || docs[i].HTML == "" || r.Error != "" || r.DuplicateOf != "" {
+			continue
+		}
+		u, err := url.Parse(docs[i].URL)
+		if err != nil || done[u.Hostname()] {
+			continue
+		}
+
+		site := tmpl.SiteContext(docs[i].URL)
+		if site == "" {
+			continue
+		}
+		done[u.Hostname()] = true
+
+		// The blocks are kept whole, and site context is supplementary, so
+		// failures only leave it empty
+		opts := p.Cleaning
+		opts.BaseURL = docs[i].URL
+		opts.Mode = cleaner.FullPage
+		opts.Boilerplate = cleaner.BoilerplateOff
+		opts.Report = false
+		cleaned, err := cleaner.Clean(site, opts)
+		if err != nil {
+			continue
+		}
+		markdown, err := converter.ToMarkdown(cleaned.HTML, p.Conversion)
+		if err != nil {
+			continue
+		}
+		if p.Normalise {
+			markdown, _ = converter.Normalise(markdown)
+		}
+		r.SiteContext = markdown
+	}
+}
+
+// newDetailLinkCheck returns a check that a listing page links to detail
+// pages not linked from the pages before it, ending pagination at error and
+// empty pages. Links are not classified, which would be slow here.
+func newDetailLinkCheck(l Listing) func(scraper.Page) bool {
+	seen := canonical.NewDeduper()
+	return func(pg scraper.Page) bool {
+		anchors, err := scraper.Anchors(pg.URL, pg.HTML, detailSelector(l))
+		if err != nil {
+			return false
+		}
+
+		var found bool
+		for _, a := range anchors {
+			if !l.candidate(pg.URL, a.URL) {
+				continue
+			}
+			if dup, err := seen.SeenURL(a.URL); err == nil && !dup {
+				found = true
+			}
+		}
+
+		return found
+	}
+}
+
+// candidate reports whether a link on a listing page may be a detail link,
+// by its host and the detail pattern
+func (l Listing) candidate(listingURL, link string) bool {
+	if l.DetailPattern != nil && !l.DetailPattern.MatchString(link) {
+		return false
+	}
+
+	return l.ExternalLinks || sameSite(listingURL, link)
+}
+
+// sameSite reports whether two URLs have the same host, ignoring any www
+// prefix
+func sameSite(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimPrefix(ua.Hostname(), "www.") == strings.TrimPrefix(ub.Hostname(), "www.")
+}
+
+// detailSelector returns the CSS selector for detail links of a listing
+func detailSelector(l Listing) string {
+	if l.DetailSelector == "" {
+		return config.DefaultDetailLinkSelector
+	}
+
+	return l.DetailSelector
+}
+
+// detailLinks returns the deduplicated detail links found across the listing pages
+func (p *Pipeline) detailLinks(ctx context.Context, pages []scraper.Page, l Listing) ([]detailLink, error) {
+	selector := detailSelector(l)
+
+	// Listing pages link to each other; never treat them as detail pages
+	dedupe := canonical.NewDeduper()
+	for _, pg := range pages {
+		_, _ = dedupe.SeenURL(pg.URL)
+	}
+
+	var links []detailLink
+	for _, pg := range pages {
+		anchors, err := scraper.Anchors(pg.URL, pg.HTML, selector)
+		if err != nil {
+			return nil, err
+		}
+
+		// Link texts are too short to detect their language alone
+		var labels []string
+		if l.ClassifyLinks {
+			labels = classificationLabels(anchorLanguage(anchors, p.Cleaning.Language))
+		}
+
+		for _, a := range anchors {
+			if !l.candidate(pg.URL, a.URL) {
+				continue
+			}
+			if seen, err := dedupe.SeenURL(a.URL); err != nil || seen {
+				continue
+			}
+			if l.ClassifyLinks {
+				ok, err := p.isDetailLink(ctx, a, labels)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+			}
+
+			links = append(links, detailLink{url: a.URL, listingURL: pg.URL})
+		}
+	}
+
+	return links, nil
+}
+
+// anchorLanguage returns the declared language, or that detected from the
+// texts of the links of a page together
+func anchorLanguage(anchors []scraper.Anchor, declared string) string {
+	if declared != "" {
+		return declared
+	}
+
+	texts := make([]string, 0, len(anchors))
+	for _, a := range anchors {
+		texts = append(texts, a.Text)
+	}
+
+	return language.Detect(strings.Join(texts, " "))
+}
+
+// isDetailLink classifies the text and path of a link against the
+// classification labels for the language of the listing. Only the job
+// posting label, the first, counts: navigation links score highly on the
+// careers and job listing labels.
+func (p *Pipeline) isDetailLink(ctx context.Context, a scraper.Anchor, labels []string) (bool, error) {
+	text := a.Text
+	if u, err := url.Parse(a.URL); err == nil {
+		text += " " + u.Path
+	}
+
+	res, err := p.Classifier.Classify(ctx, text, labels)
+	if err != nil {
+		return false, fmt.Errorf("failed to classify link %s: %w", a.URL, err)
+	}
+
+	// Labels are ordered by score, not as given
+	for i, label := range res.Labels {
+		if label == labels[0] {
+			return res.Scores[i] >= config.DetailLinkThreshold, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,413 @@
+// Package pipeline runs the scrape, clean, convert, classify and extract stages over web pages
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/budget"
+	"github.com/danmrichards/sandbox/toyscraper/internal/canonical"
+	"github.com/danmrichards/sandbox/toyscraper/internal/classifier"
+	"github.com/danmrichards/sandbox/toyscraper/internal/cleaner"
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"github.com/danmrichards/sandbox/toyscraper/internal/converter"
+	"github.com/danmrichards/sandbox/toyscraper/internal/extractor"
+	"github.com/danmrichards/sandbox/toyscraper/internal/language"
+	"github.com/danmrichards/sandbox/toyscraper/internal/schema"
+	"github.com/danmrichards/sandbox/toyscraper/internal/scraper"
+	"github.com/nlpodyssey/cybertron/pkg/tasks/zeroshotclassifier"
+)
+
+// Pipeline holds the components used to process a page. The Classifier and
+// Extractor are optional; stages without a component are skipped.
+type Pipeline struct {
+	// Classifier classifies content against the classification labels for
+	// its language
+	Classifier *classifier.ZeroShot
+
+	// Classify enables classification of page content with the Classifier
+	Classify bool
+
+	// Extractor extracts structured content using Model and Schema
+	Extractor *extractor.Extractor
+
+	// Model is the extraction model name
+	Model string
+
+	// Schema is the JSON schema used to structure extracted content
+	Schema string
+
+	// Timeout is the scraping timeout in seconds
+	Timeout int
+
+	// Cleaning configures how HTML is cleaned before conversion
+	Cleaning cleaner.Options
+
+	// FrontMatter prepends YAML front matter describing the page and its
+	// provenance to the result Markdown, text Output and first chunk. It
+	// cannot be used with the JSON and HTML formats.
+	FrontMatter bool
+
+	// Chunking, if set, splits the Markdown into chunks by heading, which
+	// are classified and extracted separately and given in the result
+	Chunking *converter.ChunkOptions
+
+	// Conversion configures the Markdown conversion of cleaned HTML
+	Conversion converter.Options
+
+	// Normalise tidies the converted Markdown, removing repeated blank
+	// lines, needless escapes, empty list items, duplicate links and blocks
+	// and cutting long link-only lists short
+	Normalise bool
+
+	// Format is the format of the result Output. Markdown is always
+	// produced, for classification and extraction.
+	Format converter.Format
+}
+
+// Result is the output of running the pipeline over a single page.
+type Result struct {
+	// URL is the page the result was produced from
+	URL string `json:"url"`
+
+	// FinalURL is the URL the content was fetched from after redirects
+	FinalURL string `json:"final_url,omitempty"`
+
+	// FetchedAt is when the content was fetched
+	FetchedAt *time.Time `json:"fetched_at,omitempty"`
+
+	// ListingURL is the listing page the URL was found on, if any
+	ListingURL string `json:"listing_url,omitempty"`
+
+	// DuplicateOf is the URL of an earlier page with the same content, if any
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+
+	// Error describes why processing this page failed, if it did
+	Error string `json:"error,omitempty"`
+
+	// ContentType is the content type of the fetched document
+	ContentType string `json:"content_type,omitempty"`
+
+	// Markdown is the cleaned page content
+	Markdown string `json:"-"`
+
+	// Chunks are the parts of the Markdown analysed separately, if chunking
+	// is enabled
+	Chunks []converter.Chunk `json:"chunks,omitempty"`
+
+	// Output is the cleaned page content in the pipeline format, if that
+	// is not Markdown
+	Output string `json:"-"`
+
+	// Language is the language of the content, as an ISO 639-1 code, if it
+	// could be determined
+	Language string `json:"language,omitempty"`
+
+	// StructuredData is the JSON-LD, microdata and RDFa embedded in the page
+	StructuredData *cleaner.StructuredData `json:"structured_data,omitempty"`
+
+	// Metadata is the page title, description, OpenGraph tags and similar
+	Metadata *cleaner.Metadata `json:"metadata,omitempty"`
+
+	// CleaningReport describes what cleaning removed, if reporting is
+	// enabled in the cleaning options
+	CleaningReport *cleaner.Report `json:"cleaning_report,omitempty"`
+
+	// NormalisationReport describes what normalisation removed from the
+	// Markdown, if it ran
+	NormalisationReport *converter.NormalisationReport `json:"normalisation_report,omitempty"`
+
+	// SiteContext is the content repeated across the pages of the site and
+	// stripped from each, given once on the first result for the site
+	SiteContext string `json:"site_context,omitempty"`
+
+	// Classification is the classifier output, if classification ran
+	Classification *zeroshotclassifier.Response `json:"classification,omitempty"`
+
+	// Extracted is the raw extraction model response, if extraction ran
+	Extracted string `json:"-"`
+
+	// JobPosting is the job posting parsed from the extracted content, if any
+	JobPosting *schema.JobPosting `json:"job_posting,omitempty"`
+}
+
+// Run scrapes a URL and processes its content.
+func (p *Pipeline) Run(ctx context.Context, url string) (*Result, error) {
+	doc, err := scraper.Fetch(url, p.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape URL: %w", err)
+	}
+
+	r := &Result{URL: url, ContentType: doc.ContentType}
+	if err = p.convert(doc, r, p.Cleaning); err != nil {
+		return nil, err
+	}
+	if err = p.analyse(ctx, r); err != nil {
+		return nil, err
+	}
+	if err = p.finalise(r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// convert sets the Markdown content of the result from a fetched document,
+// cleaning and converting HTML documents with the given options
+func (p *Pipeline) convert(doc *scraper.Document, r *Result, opts cleaner.Options) error {
+	r.FinalURL = doc.URL
+	if !doc.FetchedAt.IsZero() {
+		r.FetchedAt = &doc.FetchedAt
+	}
+
+	if doc.HTML == "" {
+		if p.Format != converter.Markdown {
+			return fmt.Errorf("%s documents can only be converted to Markdown", doc.ContentType)
+		}
+		r.Markdown = doc.Markdown
+		r.Language = opts.Language
+		if r.Language == "" {
+			r.Language = language.Detect(r.Markdown)
+		}
+		return nil
+	}
+
+	opts.BaseURL = doc.URL
+
+	cleaned, err := cleaner.Clean(doc.HTML, opts)
+	if err != nil {
+		return fmt.Errorf("failed to clean HTML: %w", err)
+	}
+	if !cleaned.StructuredData.Empty() {
+		r.StructuredData = cleaned.StructuredData
+	}
+	r.Metadata = cleaned.Metadata
+	r.Language = cleaned.Language
+	r.CleaningReport = cleaned.Report
+
+	r.Markdown, err = converter.ToMarkdown(cleaned.HTML, p.Conversion)
+	if err != nil {
+		return fmt.Errorf("failed to convert HTML to Markdown: %w", err)
+	}
+	if p.Normalise {
+		r.Markdown, r.NormalisationReport = converter.Normalise(r.Markdown)
+	}
+	if p.Format != converter.Markdown {
+		if r.Output, err = converter.Convert(cleaned.HTML, p.Format, p.Conversion); err != nil {
+			return fmt.Errorf("failed to convert HTML: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// analyse runs the classification and extraction stages over the result
+// Markdown, chunk by chunk if chunking is enabled
+func (p *Pipeline) analyse(ctx context.Context, r *Result) error {
+	if p.Chunking != nil {
+		r.Chunks = converter.ChunkMarkdown(r.Markdown, *p.Chunking)
+	}
+
+	if p.Classify && p.Classifier != nil {
+		if err := p.classify(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	if p.Extractor != nil {
+		inputs := []string{r.Markdown}
+		if len(r.Chunks) > 1 {
+			inputs = inputs[:0]
+			for _, c := range r.Chunks {
+				inputs = append(inputs, c.Markdown)
+			}
+		}
+
+		var responses []string
+		for _, input := range inputs {
+			extractedContent, err := p.Extractor.ExtractContent(ctx, p.Model, p.Schema, r.URL, input, r.Language)
+			if err != nil {
+				return fmt.Errorf("failed to extract content: %w", err)
+			}
+			responses = append(responses, extractedContent)
+
+			// Not every response parses cleanly; the raw content is kept regardless.
+			if postings, err := schema.ParseJobPostings(extractedContent); err == nil && len(postings) > 0 && r.JobPosting == nil {
+				r.JobPosting = &postings[0]
+			}
+		}
+		r.Extracted = strings.Join(responses, "\n")
+	}
+
+	return nil
+}
+
+// classify classifies the result Markdown. The classifier has an input limit
+// (1024 tokens for the default model), so the least valuable content is
+// trimmed to fit, counting tokens with the classifier's own tokenizer; with
+// chunking, each chunk of that size is classified instead, taking the best
+// score for each label.
+func (p *Pipeline) classify(ctx context.Context, r *Result) error {
+	labels := classificationLabels(r.Language)
+
+	inputs := []string{budget.Trim(r.Markdown, p.Classifier, config.ClassifierTokenBudget)}
+	if p.Chunking != nil {
+		opts := *p.Chunking
+		opts.MaxTokens = config.ClassifierTokenBudget
+		opts.Tokenizer = p.Classifier
+		inputs = inputs[:0]
+		for _, c := range converter.ChunkMarkdown(r.Markdown, opts) {
+			inputs = append(inputs, c.Markdown)
+		}
+	}
+
+	best := make(map[string]float64)
+	for _, input := range inputs {
+		res, err := p.Classifier.Classify(ctx, input, labels)
+		if err != nil {
+			return fmt.Errorf("failed to classify content: %w", err)
+		}
+		if len(inputs) == 1 {
+			r.Classification = res
+			return nil
+		}
+		for i, label := range res.Labels {
+			best[label] = max(best[label], res.Scores[i])
+		}
+	}
+	if len(best) == 0 {
+		return nil
+	}
+
+	// Labels are sorted by score, as in a single classification
+	res := &zeroshotclassifier.Response{}
+	for label := range best {
+		res.Labels = append(res.Labels, label)
+	}
+	sort.Slice(res.Labels, func(i, j int) bool {
+		return best[res.Labels[i]] > best[res.Labels[j]]
+	})
+	for _, label := range res.Labels {
+		res.Scores = append(res.Scores, best[label])
+	}
+	r.Classification = res
+
+	return nil
+}
+
+// classificationLabels returns the classification labels for content in the
+// given language, falling back to the English labels
+func classificationLabels(lang string) []string {
+	if labels, ok := config.LanguageClassificationLabels[lang]; ok {
+		return labels
+	}
+
+	return config.ClassificationLabels
+}
+
+// finalise fills gaps in the job posting from the page metadata and adds
+// front matter to the content
+func (p *Pipeline) finalise(r *Result) error {
+	if r.Metadata != nil {
+		// Without extraction, metadata is the only source of posting details
+		if r.JobPosting == nil && p.Extractor == nil {
+			r.JobPosting = &schema.JobPosting{}
+		}
+		if r.JobPosting != nil {
+			fillFromMetadata(r.JobPosting, r.Metadata)
+		}
+	}
+
+	if !p.FrontMatter {
+		return nil
+	}
+
+	// The front matter hashes the Markdown, so is built before adding it
+	fm := newFrontMatter(r)
+	var err error
+	if r.Markdown, err = converter.WithFrontMatter(r.Markdown, fm); err != nil {
+		return err
+	}
+	if r.Output != "" {
+		if r.Output, err = converter.WithFrontMatter(r.Output, fm); err != nil {
+			return err
+		}
+	}
+	if len(r.Chunks) > 0 {
+		c := &r.Chunks[0]
+		if c.Markdown, err = converter.WithFrontMatter(c.Markdown, fm); err != nil {
+			return err
+		}
+		var tok budget.Tokenizer = budget.Estimator{}
+		if p.Chunking.Tokenizer != nil {
+			tok = p.Chunking.Tokenizer
+		}
+		c.Tokens = tok.CountTokens(c.Markdown)
+	}
+
+	return nil
+}
+
+// frontMatter describes a page and where its content came from, so stored
+// Markdown is self-describing
+type frontMatter struct {
+	SourceURL           string  `yaml:"source_url"`
+	FinalURL            string  `yaml:"final_url,omitempty"`
+	FetchedAt           string  `yaml:"fetched_at,omitempty"`
+	Language            string  `yaml:"language,omitempty"`
+	ContentHash         string  `yaml:"content_hash"`
+	Classification      string  `yaml:"classification,omitempty"`
+	ClassificationScore float64 `yaml:"classification_score,omitempty"`
+
+	cleaner.Metadata `yaml:",inline"`
+}
+
+// newFrontMatter builds the front matter for a result, hashing its Markdown
+// before the front matter is added
+func newFrontMatter(r *Result) *frontMatter {
+	fm := &frontMatter{
+		SourceURL:   r.URL,
+		FinalURL:    r.FinalURL,
+		Language:    r.Language,
+		ContentHash: canonical.ContentHash(r.Markdown),
+	}
+	if r.FetchedAt != nil {
+		fm.FetchedAt = r.FetchedAt.Format(time.RFC3339)
+	}
+	if c := r.Classification; c != nil && len(c.Labels) > 0 && len(c.Scores) > 0 {
+		fm.Classification, fm.ClassificationScore = c.Labels[0], c.Scores[0]
+	}
+	if r.Metadata != nil {
+		fm.Metadata = *r.Metadata
+
+		// The declared language is only kept if none was detected, under
+		// the same key
+		if fm.Language == "" {
+			fm.Language = fm.Metadata.Lang
+		}
+		fm.Metadata.Lang = ""
+	}
+
+	return fm
+}
+
+// fillFromMetadata fills empty job posting fields that page metadata
+// reliably provides
+func fillFromMetadata(jp *schema.JobPosting, m *cleaner.Metadata) {
+	if jp.Company.Name == "" {
+		jp.Company.Name = m.SiteName
+	}
+	// Favicons are too small to stand in for a logo
+	if jp.Company.LogoURL == "" {
+		jp.Company.LogoURL = m.Logo
+	}
+	if jp.PostingDate == "" {
+		jp.PostingDate = m.Published
+	}
+	if jp.ApplicationProcess.Link == "" {
+		jp.ApplicationProcess.Link = m.ApplicationURL
+	}
+}
@@ -0,0 +1,38 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ParseJobPostings parses job postings from an extraction model response.
+//
+// The response may wrap the JSON in Markdown code fences or tags, and may hold
+// either a single object or a list of objects.
+func ParseJobPostings(response string) ([]JobPosting, error) {
+	start := strings.IndexAny(response, "[{")
+	if start == -1 {
+		return nil, fmt.Errorf("no JSON found in response")
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(strings.NewReader(response[start:])).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+
+	if raw[0] == '{' {
+		var posting JobPosting
+		if err := json.Unmarshal(raw, &posting); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job posting: %w", err)
+		}
+		return []JobPosting{posting}, nil
+	}
+
+	var postings []JobPosting
+	if err := json.Unmarshal(raw, &postings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job postings: %w", err)
+	}
+
+	return postings, nil
+}
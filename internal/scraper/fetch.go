@@ -0,0 +1,115 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"github.com/danmrichards/sandbox/toyscraper/internal/document"
+)
+
+// Document is the content fetched from a URL. HTML pages are rendered in the
+// browser and returned as HTML; supported non-HTML documents are converted
+// directly to Markdown. The browser decodes HTML pages to UTF-8 using the
+// charset of the Content-Type header, byte order mark or meta tags.
+type Document struct {
+	URL         string
+	ContentType string
+	HTML        string
+	Markdown    string
+	FetchedAt   time.Time
+}
+
+// Fetch fetches the content of a URL, detecting PDF and DOCX documents and
+// converting them to Markdown. Anything else is rendered with GetPage.
+func Fetch(url string, timeoutSeconds int) (*Document, error) {
+	fetchedAt := time.Now().UTC()
+
+	doc, err := fetchDocument(url, timeoutSeconds)
+	if err != nil {
+		return nil, err
+	} else if doc != nil {
+		doc.FetchedAt = fetchedAt
+		return doc, nil
+	}
+
+	page, err := GetPage(url, timeoutSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Document{URL: page.URL, ContentType: "text/html", HTML: page.HTML, FetchedAt: fetchedAt}, nil
+}
+
+// fetchDocument requests a URL directly and converts the response if it is a
+// supported document. A nil document means the URL should be rendered in the browser
+// instead, which includes requests the browser may still succeed at.
+//
+// A HEAD request finds the content type first, so HTML pages are only
+// downloaded by the browser. Servers that refuse HEAD requests are only sent
+// a GET if the URL looks like a document.
+func fetchDocument(url string, timeoutSeconds int) (*Document, error) {
+	client := &http.Client{Timeout: timeoutDuration(timeoutSeconds)}
+
+	head, err := client.Head(url)
+	if err == nil {
+		head.Body.Close()
+	}
+	switch {
+	case err == nil && head.StatusCode >= 200 && head.StatusCode <= 299:
+		if isHTML(head.Header.Get("Content-Type")) {
+			return nil, nil
+		}
+	case document.DetectURL(url) == document.Unknown:
+		return nil, nil
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil
+	}
+
+	// Leave HTML to the browser without downloading it twice
+	contentType := resp.Header.Get("Content-Type")
+	if isHTML(contentType) {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, config.MaxContentLength+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %v", err)
+	}
+
+	t := document.Detect(contentType, data)
+	if t == document.Unknown {
+		return nil, nil
+	}
+	if len(data) > config.MaxContentLength {
+		return nil, fmt.Errorf("document exceeds maximum allowed length (%d bytes)", config.MaxContentLength)
+	}
+
+	markdown, err := document.ToMarkdown(t, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s document: %v", t, err)
+	}
+
+	return &Document{
+		URL:         resp.Request.URL.String(),
+		ContentType: t.ContentType(),
+		Markdown:    markdown,
+	}, nil
+}
+
+// isHTML reports whether a Content-Type header is that of an HTML page
+func isHTML(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
@@ -0,0 +1,55 @@
+package scraper
+
+import (
+	"fmt"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"github.com/go-rod/rod"
+)
+
+// markHiddenJS marks the outermost elements that are not visible in the
+// rendered page: those hidden by display or visibility, clipped to
+// screen-reader-only size or aria-hidden. Transparent, zero-size and
+// off-screen elements are left, as scroll-reveal content and collapsed
+// accordions, which often hold requirements and benefits, look the same.
+const markHiddenJS = `(attr) => {
+	const skip = new Set(["SCRIPT", "STYLE", "NOSCRIPT", "TEMPLATE", "BR", "WBR"]);
+
+	const hidden = (el) => {
+		if (el.getAttribute("aria-hidden") === "true") return true;
+
+		const style = getComputedStyle(el);
+		if (style.display === "contents") return false;
+		if (style.display === "none") return true;
+		if (style.visibility === "hidden" || style.visibility === "collapse") return true;
+
+		const rect = el.getBoundingClientRect();
+		const clipped = style.clip === "rect(0px, 0px, 0px, 0px)" || style.clipPath === "inset(50%)";
+		if (clipped && rect.width <= 1 && rect.height <= 1) return true;
+
+		return false;
+	};
+
+	const walk = (el) => {
+		for (const child of el.children) {
+			if (skip.has(child.tagName)) continue;
+			if (hidden(child)) {
+				child.setAttribute(attr, "true");
+				continue;
+			}
+			walk(child);
+		}
+	};
+
+	if (document.body) walk(document.body);
+}`
+
+// markHidden marks elements that are not visible in the rendered page with
+// config.HiddenMarkerAttribute, so the cleaner can remove them
+func markHidden(page *rod.Page) error {
+	if _, err := page.Eval(markHiddenJS, config.HiddenMarkerAttribute); err != nil {
+		return fmt.Errorf("failed to mark hidden elements: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package scraper
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// Anchor is a link found in a page along with its visible text.
+type Anchor struct {
+	URL  string
+	Text string
+}
+
+// Links returns the absolute http(s) URLs of every element matching selector
+// in the HTML content, in document order. Both href and src attributes are
+// considered.
+func Links(pageURL, rawHTML, selector string) ([]string, error) {
+	anchors, err := Anchors(pageURL, rawHTML, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]string, 0, len(anchors))
+	for _, a := range anchors {
+		links = append(links, a.URL)
+	}
+
+	return links, nil
+}
+
+// Anchors returns every element matching selector in the HTML content that
+// links to an http(s) URL, with the URL resolved to absolute form.
+func Anchors(pageURL, rawHTML, selector string) ([]Anchor, error) {
+	if _, err := cascadia.ParseGroup(selector); err != nil {
+		return nil, fmt.Errorf("invalid link selector %q: %v", selector, err)
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page URL: %v", err)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(rawHTML))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	// Respect the document base element
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if b, err := url.Parse(href); err == nil {
+			base = base.ResolveReference(b)
+		}
+	}
+
+	var anchors []Anchor
+	doc.Find(selector).Each(func(_ int, s *goquery.Selection) {
+		ref, ok := s.Attr("href")
+		if !ok {
+			ref, ok = s.Attr("src")
+		}
+		if !ok {
+			return
+		}
+		if link, ok := resolveURL(base, ref); ok {
+			text := strings.Join(strings.Fields(s.Text()), " ")
+			if text == "" {
+				text, _ = s.Attr("title")
+			}
+			anchors = append(anchors, Anchor{URL: link, Text: text})
+		}
+	})
+
+	return anchors, nil
+}
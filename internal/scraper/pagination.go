@@ -0,0 +1,326 @@
+package scraper
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danmrichards/sandbox/toyscraper/internal/canonical"
+	"github.com/danmrichards/sandbox/toyscraper/internal/config"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Pagination describes how to move from one listing page to the next.
+//
+// Only one strategy is used, checked in the order URLTemplate, ButtonSelector,
+// LinkSelector. If none is set, rel=next links are followed.
+type Pagination struct {
+	// LinkSelector is a CSS selector matching the link to the next page
+	LinkSelector string
+
+	// URLTemplate is a URL containing config.PageNumberPlaceholder, which is
+	// replaced with the page number, starting at StartPage. The start URL is
+	// fetched first, and skipped if the first numbered page repeats it.
+	URLTemplate string
+
+	// StartPage is the first page number used with URLTemplate (default: 1)
+	StartPage int
+
+	// ButtonSelector is a CSS selector for a "Next" button that loads the
+	// next page in place when clicked
+	ButtonSelector string
+
+	// MaxPages is the maximum number of pages to fetch (default: config.DefaultMaxPages)
+	MaxPages int
+
+	// HasItems, if set, reports whether a page lists any items, such as new
+	// detail links. It is called for every page in order; the first page
+	// after the start page without items ends the pagination and is dropped,
+	// as are pages with an HTTP error status.
+	HasItems func(Page) bool
+}
+
+// Page is the HTML content of a single fetched page.
+type Page struct {
+	URL  string
+	HTML string
+}
+
+// GetPaginatedHTML fetches the HTML content of a listing page and each
+// subsequent page according to the pagination rules.
+func GetPaginatedHTML(startURL string, timeoutSeconds int, p Pagination) ([]Page, error) {
+	if p.MaxPages <= 0 {
+		p.MaxPages = config.DefaultMaxPages
+	}
+	if p.StartPage <= 0 {
+		p.StartPage = 1
+	}
+	if p.URLTemplate == "" && p.ButtonSelector == "" && p.LinkSelector == "" {
+		p.LinkSelector = config.DefaultNextLinkSelector
+	}
+
+	l := launcher.New().Headless(true)
+	browser := rod.New().ControlURL(l.MustLaunch()).MustConnect()
+	defer browser.MustClose()
+
+	page, err := browser.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create page: %v", err)
+	}
+	page.MustSetViewport(config.DefaultViewportWidth, config.DefaultViewportHeight, 1, false)
+	page = page.Timeout(timeoutDuration(timeoutSeconds))
+
+	switch {
+	case p.URLTemplate != "":
+		return paginateTemplate(page, startURL, p)
+	case p.ButtonSelector != "":
+		return paginateButton(page, startURL, p)
+	default:
+		return paginateLinks(page, startURL, p)
+	}
+}
+
+// PaginatedLinks fetches a listing page and its subsequent pages, returning
+// the deduplicated set of links matching linkSelector across all of them.
+func PaginatedLinks(startURL string, timeoutSeconds int, p Pagination, linkSelector string) ([]string, error) {
+	pages, err := GetPaginatedHTML(startURL, timeoutSeconds, p)
+	if err != nil {
+		return nil, err
+	}
+
+	dedupe := canonical.NewDeduper()
+	var links []string
+	for _, pg := range pages {
+		found, err := Links(pg.URL, pg.HTML, linkSelector)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range found {
+			if seen, err := dedupe.SeenURL(link); err != nil || seen {
+				continue
+			}
+			links = append(links, link)
+		}
+	}
+
+	return links, nil
+}
+
+// paginateLinks follows next page links until none remain, a page fails to
+// load or lists no items, or the page limit is reached
+func paginateLinks(page *rod.Page, startURL string, p Pagination) ([]Page, error) {
+	dedupe := canonical.NewDeduper()
+
+	var pages []Page
+	next := startURL
+	for next != "" && len(pages) < p.MaxPages {
+		if seen, err := dedupe.SeenURL(next); err != nil || seen {
+			break
+		}
+
+		current, err := loadPage(page, next)
+		if err != nil {
+			// Broken next links end the pagination
+			if len(pages) > 0 {
+				break
+			}
+			return nil, err
+		}
+		if !p.listsItems(current) && len(pages) > 0 {
+			break
+		}
+		pages = append(pages, current)
+
+		found, err := Links(current.URL, current.HTML, p.LinkSelector)
+		if err != nil {
+			return nil, err
+		}
+		next = ""
+		if len(found) > 0 {
+			next = found[0]
+		}
+	}
+
+	return pages, nil
+}
+
+// paginateTemplate fetches the start page, then numbered pages until a page
+// fails to load, lists no items or repeats the content of a previous one, or
+// the page limit is reached. Error pages often differ on every load, so they are only caught
+// by their status or by listing no items.
+func paginateTemplate(page *rod.Page, startURL string, p Pagination) ([]Page, error) {
+	dedupe := canonical.NewDeduper()
+
+	start, err := loadPage(page, startURL)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = dedupe.SeenURL(startURL)
+	_, _ = dedupe.SeenURL(start.URL)
+	dedupe.SeenContent(start.URL, start.HTML)
+	p.listsItems(start)
+	pages := []Page{start}
+
+	for n := p.StartPage; len(pages) < p.MaxPages; n++ {
+		pageURL := strings.ReplaceAll(p.URLTemplate, config.PageNumberPlaceholder, strconv.Itoa(n))
+
+		// The start URL is often the first numbered page, so that page may
+		// repeat it
+		first := n == p.StartPage
+		if seen, err := dedupe.SeenURL(pageURL); err == nil && seen && first {
+			continue
+		}
+
+		current, err := loadPage(page, pageURL)
+		if err != nil {
+			// Running past the last page is expected to fail eventually
+			break
+		}
+		if _, dup := dedupe.SeenContent(current.URL, current.HTML); dup || !p.listsItems(current) {
+			if first {
+				continue
+			}
+			break
+		}
+		pages = append(pages, current)
+	}
+
+	return pages, nil
+}
+
+// paginateButton clicks a next button until it disappears, stops changing the
+// page or the page limit is reached
+func paginateButton(page *rod.Page, startURL string, p Pagination) ([]Page, error) {
+	dedupe := canonical.NewDeduper()
+
+	current, err := loadPage(page, startURL)
+	if err != nil {
+		return nil, err
+	}
+	dedupe.SeenContent(current.URL, current.HTML)
+	p.listsItems(current)
+	pages := []Page{current}
+
+	for len(pages) < p.MaxPages {
+		has, button, err := page.Has(p.ButtonSelector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find next button: %v", err)
+		}
+		if !has {
+			break
+		}
+		if err := button.Click(proto.InputMouseButtonLeft, 1); err != nil {
+			// Disabled or hidden buttons mark the last page
+			break
+		}
+		if err := page.WaitStable(config.PaginationSettleSeconds * time.Second); err != nil {
+			// Keep the pages loaded so far
+			break
+		}
+
+		current, err = pageContent(page)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := dedupe.SeenContent(current.URL, current.HTML); dup {
+			break
+		}
+		if !p.listsItems(current) {
+			break
+		}
+		pages = append(pages, current)
+	}
+
+	return pages, nil
+}
+
+// listsItems reports whether a page lists items, assuming it does if there
+// is no HasItems check
+func (p Pagination) listsItems(pg Page) bool {
+	return p.HasItems == nil || p.HasItems(pg)
+}
+
+// loadPage navigates to a URL and returns the loaded page content. Pages
+// with an HTTP error status, such as 404 pages, fail to load.
+func loadPage(page *rod.Page, pageURL string) (Page, error) {
+	if err := page.Navigate(pageURL); err != nil {
+		return Page{}, fmt.Errorf("failed to navigate to %s: %v", pageURL, err)
+	}
+	if err := page.WaitLoad(); err != nil {
+		return Page{}, fmt.Errorf("failed to load %s: %v", pageURL, err)
+	}
+	if status := responseStatus(page); status >= 400 {
+		return Page{}, fmt.Errorf("failed to load %s: HTTP status %d", pageURL, status)
+	}
+
+	return pageContent(page)
+}
+
+// responseStatusJS returns the HTTP status of the navigation that loaded the
+// page, or 0 if the browser does not report it
+const responseStatusJS = `() => {
+	const nav = performance.getEntriesByType("navigation")[0];
+	return nav && nav.responseStatus ? nav.responseStatus : 0;
+}`
+
+// responseStatus returns the HTTP status of the loaded page, or 0 if it is
+// not known
+func responseStatus(page *rod.Page) int {
+	res, err := page.Eval(responseStatusJS)
+	if err != nil {
+		return 0
+	}
+
+	return res.Value.Int()
+}
+
+// pageContent returns the current URL and HTML content of a page, with
+// hidden elements marked
+func pageContent(page *rod.Page) (Page, error) {
+	if err := markHidden(page); err != nil {
+		return Page{}, err
+	}
+
+	info, err := page.Info()
+	if err != nil {
+		return Page{}, fmt.Errorf("failed to get page info: %v", err)
+	}
+
+	content, err := page.HTML()
+	if err != nil {
+		return Page{}, fmt.Errorf("failed to get page content: %v", err)
+	}
+
+	return Page{URL: info.URL, HTML: content}, nil
+}
+
+// timeoutDuration validates a timeout in seconds and converts it to a duration
+func timeoutDuration(timeoutSeconds int) time.Duration {
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = config.DefaultTimeout
+	} else if timeoutSeconds > config.MaxTimeout {
+		timeoutSeconds = config.MaxTimeout
+	}
+
+	return time.Duration(timeoutSeconds) * time.Second
+}
+
+// resolveURL resolves a possibly relative reference against a base URL
+func resolveURL(base *url.URL, ref string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", false
+	}
+
+	resolved := base.ResolveReference(u)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return "", false
+	}
+	resolved.Fragment = ""
+
+	return resolved.String(), true
+}
@@ -2,9 +2,6 @@
 package scraper
 
 import (
-	"fmt"
-	"time"
-
 	"github.com/danmrichards/sandbox/toyscraper/internal/config"
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/launcher"
@@ -12,13 +9,17 @@ import (
 
 // GetHTML fetches the HTML content of a specified URL
 func GetHTML(url string, timeoutSeconds int) (string, error) {
-	// Validate timeout value
-	if timeoutSeconds <= 0 {
-		timeoutSeconds = config.DefaultTimeout
-	} else if timeoutSeconds > config.MaxTimeout {
-		timeoutSeconds = config.MaxTimeout
+	p, err := GetPage(url, timeoutSeconds)
+	if err != nil {
+		return "", err
 	}
 
+	return p.HTML, nil
+}
+
+// GetPage fetches the HTML content of a specified URL along with the final
+// URL of the page after any redirects
+func GetPage(url string, timeoutSeconds int) (Page, error) {
 	// Create a new browser launcher
 	l := launcher.New().Headless(true)
 
@@ -33,16 +34,11 @@ func GetHTML(url string, timeoutSeconds int) (string, error) {
 	page.MustSetViewport(config.DefaultViewportWidth, config.DefaultViewportHeight, 1, false)
 
 	// Set timeout
-	page.Timeout(time.Duration(timeoutSeconds) * time.Second)
+	page.Timeout(timeoutDuration(timeoutSeconds))
 
 	// Wait for the page to load
 	page.MustWaitLoad()
 
-	// Get the HTML content of the entire page
-	content, err := page.HTML()
-	if err != nil {
-		return "", fmt.Errorf("failed to get page content: %v", err)
-	}
-
-	return content, nil
+	// Get the HTML content and URL of the entire page
+	return pageContent(page)
 }